@@ -9,6 +9,7 @@ import (
 	"github.com/cosmos/cosmos-sdk/client/commands/proxy"
 	"github.com/cosmos/cosmos-sdk/client/commands/query"
 	rpccmd "github.com/cosmos/cosmos-sdk/client/commands/rpc"
+	"github.com/cosmos/cosmos-sdk/client/commands/search"
 	txcmd "github.com/cosmos/cosmos-sdk/client/commands/txs"
 	authcmd "github.com/cosmos/cosmos-sdk/modules/auth/commands"
 	basecmd "github.com/cosmos/cosmos-sdk/modules/base/commands"
@@ -48,6 +49,17 @@ func prepareClientCommands() {
 		stakecmd.CmdQueryCandidate,
 		stakecmd.CmdQueryDelegatorBond,
 		stakecmd.CmdQueryDelegatorCandidates,
+		stakecmd.CmdQueryCandidateDelegators,
+		stakecmd.CmdQueryLiquidPool,
+		stakecmd.CmdQueryValidators,
+		stakecmd.CmdQueryValidatorChanges,
+		stakecmd.CmdQueryPoolChanges,
+		stakecmd.CmdQueryEpoch,
+	)
+
+	search.RootCmd.AddCommand(
+		coincmd.SentSearchCmd,
+		stakecmd.CmdSearchStake,
 	)
 
 	// set up the middleware
@@ -76,6 +88,11 @@ func prepareClientCommands() {
 		stakecmd.CmdEditCandidacy,
 		stakecmd.CmdDelegate,
 		stakecmd.CmdUnbond,
+		stakecmd.CmdStakeBatch,
+		stakecmd.CmdRevokeCandidacy,
+		stakecmd.CmdWithdrawPool,
+		stakecmd.CmdRotateConsensusKey,
+		stakecmd.CmdTransferOwnership,
 	)
 
 	clientCmd.AddCommand(
@@ -84,6 +101,7 @@ func prepareClientCommands() {
 
 		txcmd.RootCmd,
 		query.RootCmd,
+		search.RootCmd,
 		rpccmd.RootCmd,
 		lineBreak,
 
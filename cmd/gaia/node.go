@@ -1,7 +1,11 @@
 package main
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	abci "github.com/tendermint/abci/types"
 
@@ -18,6 +22,7 @@ import (
 	"github.com/cosmos/cosmos-sdk/state"
 
 	"github.com/cosmos/gaia/modules/stake"
+	stakecmd "github.com/cosmos/gaia/modules/stake/commands"
 )
 
 // nodeCmd is the entry point for this binary
@@ -50,20 +55,38 @@ func prepareNodeCommands() {
 			stake.NewHandler(),
 		)
 
+	startCmd := basecmd.GetTickStartCmd(sdk.TickerFunc(tickFn))
+	startCmd.Flags().Bool(stakecmd.FlagCheckInvariants, false,
+		"Check the stake invariants after every block, halting the node on a violation")
+
 	nodeCmd.AddCommand(
 		basecmd.GetInitCmd("fermion", []string{"stake/allowed_bond_denom/fermion"}),
-		basecmd.GetTickStartCmd(sdk.TickerFunc(tickFn)),
+		startCmd,
 		basecmd.UnsafeResetAllCmd,
+		stakecmd.CmdShowValidator,
+		stakecmd.CmdCheckStake,
 	)
 }
 
 // Tick - Called every block even if no transaction, process all queues,
 // validator rewards, and calculate the validator set difference
 func tickFn(ctx sdk.Context, store state.SimpleDB) (change []*abci.Validator, err error) {
+	// assert the stake state is consistent once all the txs are delivered
+	if viper.GetBool(stakecmd.FlagCheckInvariants) {
+		if violations := stake.Invariants(store); len(violations) > 0 {
+			return nil, fmt.Errorf("stake invariants violated at height %d: %s",
+				ctx.BlockHeight(), strings.Join(violations, "; "))
+		}
+	}
+
 	// first need to prefix the store, at this point it's a global store
 	store = stack.PrefixedStore(stake.Name(), store)
 
 	// execute Tick
-	change, err = stake.UpdateValidatorSet(store)
+	change, err = stake.UpdateValidatorSet(store, ctx.BlockHeight())
+	if err != nil {
+		return
+	}
+	stake.PruneValidatorHistory(store, ctx.BlockHeight())
 	return
 }
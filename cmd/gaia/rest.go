@@ -38,6 +38,8 @@ var (
 func prepareRestServerCommands() {
 	commands.AddBasicFlags(restServerCmd)
 	restServerCmd.PersistentFlags().IntP(flagPort, "p", 8998, "port to run the server on")
+	restServerCmd.PersistentFlags().String(stakerest.FlagWSOrigins, "",
+		"comma separated origins allowed to open the stake websocket, * for any (default the server's own)")
 }
 
 func cmdRestServer(cmd *cobra.Command, args []string) error {
@@ -71,9 +73,23 @@ func cmdRestServer(cmd *cobra.Command, args []string) error {
 		stakerest.RegisterQueryCandidates,
 		stakerest.RegisterQueryDelegatorBond,
 		stakerest.RegisterQueryDelegatorCandidates,
+		stakerest.RegisterQueryCandidateDelegators,
+		stakerest.RegisterQueryLiquidPool,
+		stakerest.RegisterQueryValidators,
+		stakerest.RegisterQueryValidatorChanges,
+		stakerest.RegisterQueryPoolChanges,
+		stakerest.RegisterQueryEpoch,
+		stakerest.RegisterSearchStake,
 		// Staking tx builders
 		stakerest.RegisterDelegate,
 		stakerest.RegisterUnbond,
+		stakerest.RegisterBatch,
+		stakerest.RegisterRevokeCandidacy,
+		stakerest.RegisterWithdrawPool,
+		stakerest.RegisterRotateConsensusKey,
+		stakerest.RegisterTransferOwnership,
+		// Staking events
+		stakerest.RegisterWebsocket,
 	}
 
 	for _, routeRegistrar := range routeRegistrars {
@@ -171,7 +171,7 @@ test02DeclareCandidacy() {
     PK2=$(cat $SERVER2/priv_validator.json | jq -r .pub_key.data)
 
     CAND_ADDR=$(getAddr $POOR)
-    TX=$(echo qwertyuiop | ${CLIENT_EXE} tx declare-candidacy --sequence=1 --amount=2fermion --name=$POOR --pubkey=$PK2 --moniker=rigey)
+    TX=$(echo qwertyuiop | ${CLIENT_EXE} tx declare-candidacy --sequence=1 --amount=2fermion --name=$POOR --validator-home=$SERVER2 --moniker=rigey)
     if [ $? != 0 ]; then return 1; fi
     HASH=$(echo $TX | jq .hash | tr -d \")
     TX_HEIGHT=$(echo $TX | jq .height)
@@ -231,8 +231,8 @@ test04Unbond() {
     checkCandidate $PK2 "5"
     checkDelegatorBond $DELA_ADDR $PK2 "3"
 
-    # attempt to unbond more shares than exist
-    TX=$(echo qwertyuiop | ${CLIENT_EXE} tx unbond --sequence=6 --shares=10 --name=$DELEGATOR --pubkey=$PK2 2>/dev/null)
+    # attempt to unbond more coins than are bonded
+    TX=$(echo qwertyuiop | ${CLIENT_EXE} tx unbond --sequence=6 --amount=10fermion --name=$DELEGATOR --pubkey=$PK2 2>/dev/null)
     if [ $? == 0 ]; then return 1; fi
     TX_HEIGHT=$(echo $TX | jq .height)
     set +u ; checkAccount $DELA_ADDR "2" $TX_HEIGHT ; set -u
@@ -240,14 +240,14 @@ test04Unbond() {
     checkDelegatorBond $DELA_ADDR $PK2 "3"
 
     # unbond entirely from the delegator
-    TX=$(echo qwertyuiop | ${CLIENT_EXE} tx unbond --sequence=6 --shares=3 --name=$DELEGATOR --pubkey=$PK2)
+    TX=$(echo qwertyuiop | ${CLIENT_EXE} tx unbond --sequence=6 --all --name=$DELEGATOR --pubkey=$PK2)
     TX_HEIGHT=$(echo $TX | jq .height)
     set +u ; checkAccount $DELA_ADDR "5" $TX_HEIGHT ; set -u
     checkCandidate $PK2 "2"
     checkDelegatorBondEmpty $DELA_ADDR $PK2
 
     # unbond a bit from the owner
-    TX=$(echo qwertyuiop | ${CLIENT_EXE} tx unbond --sequence=2 --shares=1 --name=$POOR --pubkey=$PK2)
+    TX=$(echo qwertyuiop | ${CLIENT_EXE} tx unbond --sequence=2 --amount=1fermion --name=$POOR --pubkey=$PK2)
     TX_HEIGHT=$(echo $TX | jq .height)
     set +u ; checkAccount $CAND_ADDR "991" $TX_HEIGHT ; set -u
     checkCandidate $PK2 "1"
@@ -0,0 +1,118 @@
+package stake
+
+import (
+	"bytes"
+	"sort"
+
+	abci "github.com/tendermint/abci/types"
+	crypto "github.com/tendermint/go-crypto"
+)
+
+// limitChurn - the part of the changes to the validators vs which moves at
+// most maxChurn basis points of their total power. The decreases get half of
+// that, or all that the increases leave, and the increases the rest, so that
+// a set being replaced can't lose its power before the new validators join.
+// Each side is made in pubkey order, the change which doesn't fit in what is
+// left is made in part, moving the validator's power towards the new one. A
+// maxChurn of zero, or validators without any power, don't limit the changes.
+func limitChurn(vs Validators, changed []*abci.Validator, maxChurn uint64) []*abci.Validator {
+
+	power := make(map[string]uint64, len(vs))
+	var total uint64
+	for _, v := range vs {
+		power[string(pubKeyBytes(v.PubKey))] = v.VotingPower
+		total += v.VotingPower
+	}
+	if maxChurn == 0 || total == 0 {
+		return changed
+	}
+
+	// at least one unit of power can always change, so a small set can't get
+	// stuck on a change it could never make
+	left, _ := mulDiv(total, maxChurn, maxRatio)
+	if left == 0 {
+		left = 1
+	}
+
+	var decreases, increases []*abci.Validator
+	var down, up uint64
+	for _, c := range changed {
+		before, after := power[string(c.PubKey)], uint64(c.Power)
+		if after < before {
+			decreases = append(decreases, c)
+			down += before - after
+		} else {
+			increases = append(increases, c)
+			up += after - before
+		}
+	}
+	downLeft := left / 2
+	if up < left-downLeft {
+		downLeft = left - up
+	}
+	if down < downLeft {
+		downLeft = down
+	}
+
+	applied := stepChanges(decreases, power, downLeft)
+	return append(applied, stepChanges(increases, power, left-downLeft)...)
+}
+
+// stepChanges - the changes, in pubkey order, which move at most left power
+// from the validators' power before. The first which doesn't fit is made in
+// part and the rest are left out.
+func stepChanges(changed []*abci.Validator, power map[string]uint64,
+	left uint64) (applied []*abci.Validator) {
+
+	ordered := append([]*abci.Validator{}, changed...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return bytes.Compare(ordered[i].PubKey, ordered[j].PubKey) == -1
+	})
+
+	for _, c := range ordered {
+		before, after := power[string(c.PubKey)], uint64(c.Power)
+		moved := after - before
+		step := before + left
+		if after < before {
+			moved = before - after
+			step = before - left
+		}
+
+		switch {
+		case moved <= left:
+			left -= moved
+			applied = append(applied, c)
+		case left > 0:
+			applied = append(applied, &abci.Validator{PubKey: c.PubKey, Power: int64(step)})
+			left = 0
+		}
+	}
+	return applied
+}
+
+// applyValidatorChanges - the validators vs after the changes reported to
+// Tendermint, sorted by pubkey
+func applyValidatorChanges(vs Validators, changed []*abci.Validator) (Validators, error) {
+	set := make(map[string]Validator, len(vs))
+	for _, v := range vs {
+		set[string(pubKeyBytes(v.PubKey))] = v
+	}
+	for _, c := range changed {
+		if c.Power == 0 {
+			delete(set, string(c.PubKey))
+			continue
+		}
+		pk, err := crypto.PubKeyFromBytes(c.PubKey)
+		if err != nil {
+			return nil, err
+		}
+		set[string(c.PubKey)] = Validator{PubKey: pk, VotingPower: uint64(c.Power)}
+	}
+
+	applied := make(Validators, 0, len(set))
+	for _, v := range set {
+		applied = append(applied, v)
+	}
+	applied.Sort()
+	return applied, nil
+}
@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	sdk "github.com/cosmos/cosmos-sdk"
+	"github.com/cosmos/cosmos-sdk/modules/coin"
+
+	"github.com/cosmos/gaia/modules/stake"
+)
+
+// nolint
+const (
+	FlagBatchFile = "file"
+
+	BatchOpDelegate      = "delegate"
+	BatchOpUnbond        = "unbond"
+	BatchOpEditCandidacy = "edit-candidacy"
+)
+
+// CmdStakeBatch - apply several stake operations in one atomic transaction
+var CmdStakeBatch = &cobra.Command{
+	Use:   "stake-batch",
+	Short: "delegate, unbond and edit candidacies in a single atomic transaction",
+	Long: `Read a list of stake operations from a JSON file and send them as a
+single transaction, either all of the operations are applied or none are.
+
+Example file:
+[
+  {"type": "delegate", "pub_key": "<pubkey>", "amount": "10fermion"},
+  {"type": "unbond", "pub_key": "<pubkey>", "shares": 10},
+  {"type": "unbond", "pub_key": "<pubkey>", "all": true},
+  {"type": "edit-candidacy", "pub_key": "<pubkey>", "moniker": "foo"}
+]`,
+	RunE: cmdStakeBatch,
+}
+
+func init() {
+	CmdStakeBatch.Flags().String(FlagBatchFile, "", "JSON file with the list of stake operations")
+	CmdStakeBatch.Flags().AddFlagSet(fsActAs)
+}
+
+// BatchOp - one operation of a stake batch, as read from a batch file or a
+// REST request. Unbonds take exactly one of amount, shares and all, where
+// amount and all are converted to shares using the current state, before any
+// of the operations in the batch are applied.
+type BatchOp struct {
+	Type   string `json:"type"`
+	PubKey string `json:"pub_key"`
+	Amount string `json:"amount,omitempty"`
+	Shares uint64 `json:"shares,omitempty"`
+	All    bool   `json:"all,omitempty"`
+
+	stake.Description
+}
+
+func cmdStakeBatch(cmd *cobra.Command, args []string) error {
+	file := viper.GetString(FlagBatchFile)
+	if file == "" {
+		return fmt.Errorf("must use --%v flag", FlagBatchFile)
+	}
+	bz, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var ops []BatchOp
+	err = json.Unmarshal(bz, &ops)
+	if err != nil {
+		return fmt.Errorf("error reading batch file %v: %v", file, err)
+	}
+
+	delegator, err := getActor()
+	if err != nil {
+		return err
+	}
+	tx, err := NewTxStakeBatch(delegator, ops)
+	if err != nil {
+		return err
+	}
+	return doTx(tx)
+}
+
+// NewTxStakeBatch - build the batch transaction for the delegator
+func NewTxStakeBatch(delegator sdk.Actor, ops []BatchOp) (sdk.Tx, error) {
+	if len(ops) == 0 {
+		return sdk.Tx{}, fmt.Errorf("batch must contain at least one operation")
+	}
+	txs := make([]sdk.Tx, len(ops))
+	for i, op := range ops {
+		tx, err := op.tx(delegator)
+		if err != nil {
+			return sdk.Tx{}, fmt.Errorf("batch operation %d: %v", i, err)
+		}
+		txs[i] = tx
+	}
+	return stake.NewTxStakeBatch(txs), nil
+}
+
+func (op BatchOp) tx(delegator sdk.Actor) (tx sdk.Tx, err error) {
+	pk, err := GetPubKey(op.PubKey)
+	if err != nil {
+		return
+	}
+
+	switch op.Type {
+	case BatchOpDelegate:
+		var amount coin.Coin
+		amount, err = coin.ParseCoin(op.Amount)
+		if err != nil {
+			return
+		}
+		return stake.NewTxDelegate(amount, pk), nil
+
+	case BatchOpUnbond:
+		set := 0
+		for _, isSet := range []bool{op.Amount != "", op.All, op.Shares != 0} {
+			if isSet {
+				set++
+			}
+		}
+		if set != 1 {
+			err = fmt.Errorf("unbond needs exactly one of amount, all and shares")
+			return
+		}
+
+		shares := op.Shares
+		switch {
+		case op.All:
+			shares, err = GetUnbondShares(delegator, pk, nil)
+		case op.Amount != "":
+			var amount coin.Coin
+			amount, err = coin.ParseCoin(op.Amount)
+			if err != nil {
+				return
+			}
+			shares, err = GetUnbondShares(delegator, pk, &amount)
+		}
+		if err != nil {
+			return
+		}
+		return stake.NewTxUnbond(shares, pk), nil
+
+	case BatchOpEditCandidacy:
+		return stake.NewTxEditCandidacy(pk, op.Description), nil
+	}
+
+	err = fmt.Errorf("unknown operation type %q, use %v, %v or %v", op.Type,
+		BatchOpDelegate, BatchOpUnbond, BatchOpEditCandidacy)
+	return
+}
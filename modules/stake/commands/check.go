@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/tendermint/tmlibs/cli"
+	"github.com/tendermint/tmlibs/log"
+
+	"github.com/cosmos/cosmos-sdk/app"
+	basecmd "github.com/cosmos/cosmos-sdk/server/commands"
+
+	"github.com/cosmos/gaia/modules/stake"
+)
+
+// nolint
+const (
+	FlagCheckInvariants = "check-stake-invariants"
+)
+
+// CmdCheckStake - check the stake invariants of the node's committed state
+var CmdCheckStake = &cobra.Command{
+	Use:   "check-stake",
+	Short: "Check the stake invariants on the node's last committed state, the node must be stopped",
+	RunE:  cmdCheckStake,
+}
+
+func cmdCheckStake(cmd *cobra.Command, args []string) error {
+	rootDir := viper.GetString(cli.HomeFlag)
+	storeApp, err := app.NewStoreApp("check-stake",
+		path.Join(rootDir, "data", "merkleeyes.db"),
+		basecmd.EyesCacheSize,
+		log.NewNopLogger())
+	if err != nil {
+		return err
+	}
+
+	violations := stake.Invariants(storeApp.Check())
+	for _, v := range violations {
+		fmt.Println(v)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("%d stake invariant violations at height %d",
+			len(violations), storeApp.CommittedHeight())
+	}
+	fmt.Printf("stake invariants hold at height %d\n", storeApp.CommittedHeight())
+	return nil
+}
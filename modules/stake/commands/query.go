@@ -1,12 +1,16 @@
 package commands
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	crypto "github.com/tendermint/go-crypto"
 
+	sdk "github.com/cosmos/cosmos-sdk"
+	"github.com/cosmos/cosmos-sdk/client"
 	"github.com/cosmos/cosmos-sdk/client/commands"
 	"github.com/cosmos/cosmos-sdk/client/commands/query"
 	"github.com/cosmos/cosmos-sdk/modules/coin"
@@ -40,20 +44,66 @@ var (
 		Short: "Query all delegators candidates' pubkeys based on address",
 	}
 
+	CmdQueryCandidateDelegators = &cobra.Command{
+		Use:   "candidate-delegators",
+		RunE:  cmdQueryCandidateDelegators,
+		Short: "Query a page of the delegators bonded to a candidate, with their bonds",
+	}
+
+	CmdQueryValidators = &cobra.Command{
+		Use:   "validators",
+		RunE:  cmdQueryValidators,
+		Short: "Query the validator set of the block --height, or of the latest block",
+	}
+
+	CmdQueryValidatorChanges = &cobra.Command{
+		Use:   "validator-changes",
+		RunE:  cmdQueryValidatorChanges,
+		Short: "Query the validator power changes made at the block --height",
+	}
+
+	CmdQueryPoolChanges = &cobra.Command{
+		Use:   "pool-changes",
+		RunE:  cmdQueryPoolChanges,
+		Short: "Query the bonds moved into or out of the liquid pools at the block --height",
+	}
+
+	CmdQueryEpoch = &cobra.Command{
+		Use:   "epoch",
+		RunE:  cmdQueryEpoch,
+		Short: "Query the epoch of the next block and the height its validator set update is made at",
+	}
+
+	CmdQueryLiquidPool = &cobra.Command{
+		Use:   "liquid-pool",
+		RunE:  cmdQueryLiquidPool,
+		Short: "Query the coins of each delegator in the liquid pool of a candidate",
+	}
+
 	FlagDelegatorAddress = "delegator-address"
+	FlagStart            = "start"
+	FlagLimit            = "limit"
 )
 
+// DefaultPageLimit - the number of delegators returned per page by default
+const DefaultPageLimit = 100
+
 func init() {
 	//Add Flags
 	fsPk := flag.NewFlagSet("", flag.ContinueOnError)
-	fsPk.String(FlagPubKey, "", "PubKey of the validator-candidate")
+	fsPk.String(FlagPubKey, "", "PubKey of the validator-candidate (hex, base64 or json)")
 	fsAddr := flag.NewFlagSet("", flag.ContinueOnError)
 	fsAddr.String(FlagDelegatorAddress, "", "Delegator Hex Address")
 
 	CmdQueryCandidate.Flags().AddFlagSet(fsPk)
+	CmdQueryLiquidPool.Flags().AddFlagSet(fsPk)
 	CmdQueryDelegatorBond.Flags().AddFlagSet(fsPk)
 	CmdQueryDelegatorBond.Flags().AddFlagSet(fsAddr)
 	CmdQueryDelegatorCandidates.Flags().AddFlagSet(fsAddr)
+
+	CmdQueryCandidateDelegators.Flags().AddFlagSet(fsPk)
+	CmdQueryCandidateDelegators.Flags().Int(FlagStart, 0, "Index of the first delegator of the page")
+	CmdQueryCandidateDelegators.Flags().Int(FlagLimit, DefaultPageLimit, "Maximum number of delegators in the page")
 }
 
 func cmdQueryCandidates(cmd *cobra.Command, args []string) error {
@@ -89,6 +139,25 @@ func cmdQueryCandidate(cmd *cobra.Command, args []string) error {
 	return query.OutputProof(candidate, height)
 }
 
+func cmdQueryLiquidPool(cmd *cobra.Command, args []string) error {
+
+	var pool stake.LiquidPool
+
+	pk, err := GetPubKey(viper.GetString(FlagPubKey))
+	if err != nil {
+		return err
+	}
+
+	prove := !viper.GetBool(commands.FlagTrustNode)
+	key := stack.PrefixedKey(stake.Name(), stake.GetLiquidPoolKey(pk))
+	height, err := query.GetParsed(key, &pool, query.GetHeight(), prove)
+	if err != nil {
+		return err
+	}
+
+	return query.OutputProof(pool, height)
+}
+
 func cmdQueryDelegatorBond(cmd *cobra.Command, args []string) error {
 
 	var bond stake.DelegatorBond
@@ -134,3 +203,193 @@ func cmdQueryDelegatorCandidates(cmd *cobra.Command, args []string) error {
 
 	return query.OutputProof(candidates, height)
 }
+
+func cmdQueryCandidateDelegators(cmd *cobra.Command, args []string) error {
+
+	pk, err := GetPubKey(viper.GetString(FlagPubKey))
+	if err != nil {
+		return err
+	}
+
+	page, height, err := GetCandidateDelegators(pk, viper.GetInt(FlagStart),
+		viper.GetInt(FlagLimit), query.GetHeight())
+	if err != nil {
+		return err
+	}
+
+	return query.OutputProof(page, height)
+}
+
+// DelegatorsPage - a page of the delegators bonded to a candidate
+type DelegatorsPage struct {
+	Total      int             `json:"total"`
+	Start      int             `json:"start"`
+	Delegators []CandidateBond `json:"delegators"`
+}
+
+// CandidateBond - a delegator and its bond with the candidate
+type CandidateBond struct {
+	Delegator sdk.Actor           `json:"delegator"`
+	Bond      stake.DelegatorBond `json:"bond"`
+}
+
+// GetCandidateDelegators - get the page of limit delegators from index start
+// of the candidate's delegators, with their bonds. Only the count and the
+// page are queried, all proven at the same height, the latest one for
+// height 0.
+func GetCandidateDelegators(pk crypto.PubKey, start, limit int,
+	height int64) (page DelegatorsPage, proofHeight int64, err error) {
+
+	if start < 0 || limit <= 0 {
+		return page, 0, fmt.Errorf("start cannot be negative and limit must be positive")
+	}
+
+	prove := !viper.GetBool(commands.FlagTrustNode)
+	key := stack.PrefixedKey(stake.Name(), stake.GetDelegatorsCountKey(pk))
+	var total int64
+	proofHeight, err = query.GetParsed(key, &total, height, prove)
+	if client.IsNoDataErr(err) {
+		total, err = 0, nil // no delegators
+	}
+	if err != nil {
+		return page, 0, err
+	}
+
+	page.Total, page.Start = int(total), start
+	page.Delegators = []CandidateBond{}
+	end := start + limit
+	if end > page.Total {
+		end = page.Total
+	}
+
+	for i := start; i < end; i++ {
+		var delegator sdk.Actor
+		key := stack.PrefixedKey(stake.Name(), stake.GetDelegatorAtKey(pk, int64(i)))
+		_, err = query.GetParsed(key, &delegator, proofHeight, prove)
+		if err != nil {
+			return page, 0, err
+		}
+		var bond stake.DelegatorBond
+		key = stack.PrefixedKey(stake.Name(), stake.GetDelegatorBondKey(delegator, pk))
+		_, err = query.GetParsed(key, &bond, proofHeight, prove)
+		if err != nil {
+			return page, 0, err
+		}
+		page.Delegators = append(page.Delegators, CandidateBond{delegator, bond})
+	}
+	return page, proofHeight, nil
+}
+
+func cmdQueryValidatorChanges(cmd *cobra.Command, args []string) error {
+
+	height := query.GetHeight()
+	if height <= 0 {
+		return fmt.Errorf("must use --%v flag", query.FlagHeight)
+	}
+
+	// the changes are stored by height, so can be read from the latest state
+	prove := !viper.GetBool(commands.FlagTrustNode)
+	key := stack.PrefixedKey(stake.Name(), stake.GetValidatorChangesKey(height))
+	var changes []stake.ValidatorChange
+	proofHeight, err := query.GetParsed(key, &changes, 0, prove)
+	if client.IsNoDataErr(err) {
+		changes, err = nil, nil // no changes at this height
+	}
+	if err != nil {
+		return err
+	}
+
+	return query.OutputProof(changes, proofHeight)
+}
+
+func cmdQueryPoolChanges(cmd *cobra.Command, args []string) error {
+
+	height := query.GetHeight()
+	if height <= 0 {
+		return fmt.Errorf("must use --%v flag", query.FlagHeight)
+	}
+
+	// the changes are stored by height, so can be read from the latest state
+	prove := !viper.GetBool(commands.FlagTrustNode)
+	key := stack.PrefixedKey(stake.Name(), stake.GetPoolChangesKey(height))
+	var changes []stake.PoolChange
+	proofHeight, err := query.GetParsed(key, &changes, 0, prove)
+	if client.IsNoDataErr(err) {
+		changes, err = nil, nil // no changes at this height
+	}
+	if err != nil {
+		return err
+	}
+
+	return query.OutputProof(changes, proofHeight)
+}
+
+func cmdQueryEpoch(cmd *cobra.Command, args []string) error {
+	epoch, height, err := GetEpoch()
+	if err != nil {
+		return err
+	}
+	return query.OutputProof(epoch, height)
+}
+
+// GetEpoch - get the epoch of the block after the latest one, from the
+// params of the latest state
+func GetEpoch() (epoch stake.Epoch, proofHeight int64, err error) {
+	var params stake.Params
+	prove := !viper.GetBool(commands.FlagTrustNode)
+	key := stack.PrefixedKey(stake.Name(), stake.ParamKey)
+	proofHeight, err = query.GetParsed(key, &params, 0, prove)
+	if client.IsNoDataErr(err) {
+		// no params set at genesis, an epoch is one block
+		status, err := commands.GetNode().Status()
+		if err != nil {
+			return epoch, 0, err
+		}
+		proofHeight = status.LatestBlockHeight
+		return stake.GetEpoch(params, proofHeight+1), proofHeight, nil
+	}
+	if err != nil {
+		return
+	}
+	return stake.GetEpoch(params, proofHeight+1), proofHeight, nil
+}
+
+func cmdQueryValidators(cmd *cobra.Command, args []string) error {
+	validators, height, err := GetValidatorSet(query.GetHeight())
+	if err != nil {
+		return err
+	}
+	return query.OutputProof(validators, height)
+}
+
+// GetValidatorSet - get the validator set which validated the block at the
+// height, or the latest block for height 0. The sets are stored by height so
+// are read from the latest state, following the height back to the one the
+// set was stored at if it didn't change.
+func GetValidatorSet(height int64) (validators []stake.ValidatorPower,
+	proofHeight int64, err error) {
+
+	if height < 0 {
+		return nil, 0, fmt.Errorf("height cannot be negative")
+	}
+	if height == 0 {
+		status, err := commands.GetNode().Status()
+		if err != nil {
+			return nil, 0, err
+		}
+		height = status.LatestBlockHeight
+	}
+
+	prove := !viper.GetBool(commands.FlagTrustNode)
+	var info stake.ValidatorSetInfo
+	key := stack.PrefixedKey(stake.Name(), stake.GetValidatorSetKey(height))
+	proofHeight, err = query.GetParsed(key, &info, 0, prove)
+	if err == nil && info.ChangedHeight != height {
+		key = stack.PrefixedKey(stake.Name(), stake.GetValidatorSetKey(info.ChangedHeight))
+		_, err = query.GetParsed(key, &info, proofHeight, prove)
+	}
+	if client.IsNoDataErr(err) {
+		err = fmt.Errorf("no validator set stored for height %d", height)
+	}
+	return info.Validators, proofHeight, err
+}
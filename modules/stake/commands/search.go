@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	sdk "github.com/cosmos/cosmos-sdk"
+	"github.com/cosmos/cosmos-sdk/client/commands"
+	"github.com/cosmos/cosmos-sdk/client/commands/search"
+	"github.com/cosmos/cosmos-sdk/errors"
+
+	"github.com/cosmos/gaia/modules/stake"
+)
+
+// nolint
+const (
+	FlagAction    = "action"
+	FlagDelegator = "delegator"
+)
+
+// CmdSearchStake - find stake txs by their tags
+var CmdSearchStake = &cobra.Command{
+	Use:   "stake",
+	Short: "Find all stake txs for a delegator, candidate and/or action",
+	RunE:  commands.RequireInit(cmdSearchStake),
+}
+
+func init() {
+	CmdSearchStake.Flags().String(FlagDelegator, "", "Delegator address")
+	CmdSearchStake.Flags().String(FlagPubKey, "", "PubKey of the validator-candidate (hex, base64 or json)")
+	CmdSearchStake.Flags().String(FlagAction, "", fmt.Sprintf("Only this action: %v, %v, %v, %v, %v, %v, %v or %v",
+		stake.ActionDeclareCandidacy, stake.ActionEditCandidacy, stake.ActionDelegate, stake.ActionUnbond,
+		stake.ActionRotateConsensusKey, stake.ActionTransferOwnership, stake.ActionRevokeCandidacy,
+		stake.ActionWithdrawPool))
+}
+
+func cmdSearchStake(cmd *cobra.Command, args []string) error {
+	q, err := StakeSearchQuery(viper.GetString(FlagDelegator), viper.GetString(FlagPubKey),
+		viper.GetString(FlagAction), viper.GetInt(search.FlagMinHeight), viper.GetInt(search.FlagMaxHeight))
+	if err != nil {
+		return err
+	}
+
+	prove := !viper.GetBool(commands.FlagTrustNode)
+	all, err := search.FindAnyTx(prove, q)
+	if err != nil {
+		return err
+	}
+
+	output, err := search.FormatSearch(all, ExtractStakeTx)
+	if err != nil {
+		return err
+	}
+	return search.Output(output)
+}
+
+// StakeSearchQuery - build the tx search query matching all of the given
+// stake tags, empty arguments and zero heights are left out
+func StakeSearchQuery(delegator, pubKey, action string, minHeight, maxHeight int) (string, error) {
+	var conds []string
+	if delegator != "" {
+		act, err := commands.ParseActor(delegator)
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, fmt.Sprintf("%s='%s'", stake.TagDelegator, act))
+	}
+	if pubKey != "" {
+		pk, err := GetPubKey(pubKey)
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, fmt.Sprintf("%s='%s'", stake.TagCandidate, pk.KeyString()))
+	}
+	if action != "" {
+		conds = append(conds, fmt.Sprintf("%s='%s'", stake.TagAction, action))
+	}
+	if len(conds) == 0 {
+		return "", fmt.Errorf("search needs a delegator, pubkey and/or action")
+	}
+
+	if minHeight > 0 {
+		conds = append(conds, fmt.Sprintf("tx.height>=%d", minHeight))
+	}
+	if maxHeight > 0 {
+		conds = append(conds, fmt.Sprintf("tx.height<=%d", maxHeight))
+	}
+	return strings.Join(conds, " AND "), nil
+}
+
+// ExtractStakeTx - get the stake tx out of the raw tx bytes
+func ExtractStakeTx(data []byte) (interface{}, error) {
+	tx, err := sdk.LoadTx(data)
+	if err != nil {
+		return nil, err
+	}
+	txl, ok := tx.Unwrap().(sdk.TxLayer)
+	for ok {
+		tx = txl.Next()
+		txl, ok = tx.Unwrap().(sdk.TxLayer)
+	}
+
+	// a tx run for another actor is shown as the tx it runs
+	if actAs, ok := tx.Unwrap().(stake.TxActAs); ok {
+		tx = actAs.Tx
+	}
+
+	switch tx.Unwrap().(type) {
+	case stake.TxDeclareCandidacy, stake.TxEditCandidacy,
+		stake.TxDelegate, stake.TxUnbond, stake.TxStakeBatch,
+		stake.TxRotateConsensusKey, stake.TxTransferOwnership,
+		stake.TxRevokeCandidacy, stake.TxWithdrawPool:
+		return tx, nil
+	}
+	return nil, errors.ErrUnknownTxType(tx)
+}
@@ -1,8 +1,11 @@
 package commands
 
 import (
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 	flag "github.com/spf13/pflag"
@@ -10,22 +13,33 @@ import (
 
 	crypto "github.com/tendermint/go-crypto"
 
+	sdk "github.com/cosmos/cosmos-sdk"
+	"github.com/cosmos/cosmos-sdk/client"
+	"github.com/cosmos/cosmos-sdk/client/commands"
+	"github.com/cosmos/cosmos-sdk/client/commands/query"
 	txcmd "github.com/cosmos/cosmos-sdk/client/commands/txs"
 	"github.com/cosmos/cosmos-sdk/modules/coin"
+	"github.com/cosmos/cosmos-sdk/stack"
 
 	"github.com/cosmos/gaia/modules/stake"
 )
 
 // nolint
 const (
-	FlagPubKey = "pubkey"
-	FlagAmount = "amount"
-	FlagShares = "shares"
+	FlagPubKey   = "pubkey"
+	FlagNewOwner = "new-owner"
+	FlagAmount   = "amount"
+	FlagShares   = "shares"
+	FlagAll      = "all"
+	FlagActAs    = "act-as"
 
 	FlagMoniker  = "moniker"
 	FlagIdentity = "keybase-sig"
 	FlagWebsite  = "website"
 	FlagDetails  = "details"
+
+	FlagMinSelfBondRatio   = "min-self-bond-ratio"
+	FlagMaxTotalDelegation = "max-total-delegation"
 )
 
 // nolint
@@ -50,19 +64,49 @@ var (
 		Short: "unbond coins from a validator/candidate",
 		RunE:  cmdUnbond,
 	}
+	CmdRevokeCandidacy = &cobra.Command{
+		Use:   "revoke-candidacy",
+		Short: "withdraw a validator-candidate, returning the coins of all its delegators",
+		RunE:  cmdRevokeCandidacy,
+	}
+	CmdWithdrawPool = &cobra.Command{
+		Use:   "withdraw-pool",
+		Short: "take your coins out of the liquid pool of a validator-candidate which stopped validating",
+		RunE:  cmdWithdrawPool,
+	}
+	CmdRotateConsensusKey = &cobra.Command{
+		Use:   "rotate-consensus-key",
+		Short: "move a validator-candidate and all its delegations to a new consensus pubkey",
+		RunE:  cmdRotateConsensusKey,
+	}
+	CmdTransferOwnership = &cobra.Command{
+		Use:   "transfer-ownership",
+		Short: "hand a validator-candidate and its self-bond over to a new owner",
+		RunE:  cmdTransferOwnership,
+	}
 )
 
+// fsActAs - flag to run a stake tx for another actor than the signer, set up
+// before any init adds it to a command
+var fsActAs = func() *flag.FlagSet {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.String(FlagActAs, "", "Actor the tx acts for instead of the signer, such as a role, as [chain/][app:]hex")
+	return fs
+}()
+
 func init() {
 
 	// define the flags
 	fsPk := flag.NewFlagSet("", flag.ContinueOnError)
-	fsPk.String(FlagPubKey, "", "PubKey of the validator-candidate")
+	fsPk.String(FlagPubKey, "", "PubKey of the validator-candidate (hex, base64 or json)")
 
 	fsAmount := flag.NewFlagSet("", flag.ContinueOnError)
 	fsAmount.String(FlagAmount, "1fermion", "Amount of coins to bond")
 
-	fsShares := flag.NewFlagSet("", flag.ContinueOnError)
-	fsShares.Int64(FlagShares, 0, "Amount of shares to unbond")
+	fsUnbond := flag.NewFlagSet("", flag.ContinueOnError)
+	fsUnbond.String(FlagAmount, "", "Amount of coins to unbond, converted to shares at the candidate's current rate")
+	fsUnbond.Bool(FlagAll, false, "Unbond all shares")
+	fsUnbond.Int64(FlagShares, 0, "Amount of shares to unbond")
 
 	fsCandidate := flag.NewFlagSet("", flag.ContinueOnError)
 	fsCandidate.String(FlagMoniker, "", "validator-candidate name")
@@ -70,19 +114,41 @@ func init() {
 	fsCandidate.String(FlagWebsite, "", "optional website")
 	fsCandidate.String(FlagDetails, "", "optional detailed description space")
 
+	fsThreshold := flag.NewFlagSet("", flag.ContinueOnError)
+	fsThreshold.Int64(FlagMinSelfBondRatio, 0, "Stop validating below this self-bond part of all shares, in basis points (0 disables)")
+	fsThreshold.Int64(FlagMaxTotalDelegation, 0, "Stop validating above this many coins bonded in total (0 disables)")
+
 	// add the flags
 	CmdDelegate.Flags().AddFlagSet(fsPk)
 	CmdDelegate.Flags().AddFlagSet(fsAmount)
 
 	CmdUnbond.Flags().AddFlagSet(fsPk)
-	CmdUnbond.Flags().AddFlagSet(fsShares)
+	CmdUnbond.Flags().AddFlagSet(fsUnbond)
 
-	CmdDeclareCandidacy.Flags().AddFlagSet(fsPk)
+	CmdDeclareCandidacy.Flags().AddFlagSet(fsValidator)
 	CmdDeclareCandidacy.Flags().AddFlagSet(fsAmount)
 	CmdDeclareCandidacy.Flags().AddFlagSet(fsCandidate)
+	CmdDeclareCandidacy.Flags().AddFlagSet(fsThreshold)
 
 	CmdEditCandidacy.Flags().AddFlagSet(fsPk)
+	CmdEditCandidacy.Flags().AddFlagSet(fsValidator)
 	CmdEditCandidacy.Flags().AddFlagSet(fsCandidate)
+	CmdEditCandidacy.Flags().AddFlagSet(fsThreshold)
+
+	CmdRevokeCandidacy.Flags().AddFlagSet(fsPk)
+
+	CmdWithdrawPool.Flags().AddFlagSet(fsPk)
+
+	CmdRotateConsensusKey.Flags().AddFlagSet(fsPk)
+	CmdRotateConsensusKey.Flags().AddFlagSet(fsValidator)
+
+	CmdTransferOwnership.Flags().AddFlagSet(fsPk)
+	CmdTransferOwnership.Flags().String(FlagNewOwner, "", "Address of the new owner, as [chain/][app:]hex")
+
+	for _, cmd := range []*cobra.Command{CmdDeclareCandidacy, CmdEditCandidacy, CmdDelegate,
+		CmdUnbond, CmdRevokeCandidacy, CmdWithdrawPool, CmdRotateConsensusKey, CmdTransferOwnership} {
+		cmd.Flags().AddFlagSet(fsActAs)
+	}
 }
 
 func cmdDeclareCandidacy(cmd *cobra.Command, args []string) error {
@@ -91,10 +157,17 @@ func cmdDeclareCandidacy(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	pk, err := GetPubKey(viper.GetString(FlagPubKey))
+	// the consensus key proves the candidacy is declared by its holder
+	privVal, err := getPrivValidator()
 	if err != nil {
 		return err
 	}
+	owner, err := getActor()
+	if err != nil {
+		return err
+	}
+	signBytes := stake.CandidacySignBytes(commands.GetChainID(), owner)
+	pubKeySig := privVal.PrivKey.Sign(signBytes)
 
 	if viper.GetString(FlagMoniker) == "" {
 		return fmt.Errorf("please enter a moniker for the validator-candidate using --moniker")
@@ -107,13 +180,18 @@ func cmdDeclareCandidacy(cmd *cobra.Command, args []string) error {
 		Details:  viper.GetString(FlagDetails),
 	}
 
-	tx := stake.NewTxDeclareCandidacy(amount, pk, description)
-	return txcmd.DoTx(tx)
+	threshold, err := getThreshold()
+	if err != nil {
+		return err
+	}
+
+	tx := stake.NewTxDeclareCandidacy(amount, privVal.PubKey, description, threshold, pubKeySig)
+	return doTx(tx)
 }
 
 func cmdEditCandidacy(cmd *cobra.Command, args []string) error {
 
-	pk, err := GetPubKey(viper.GetString(FlagPubKey))
+	pk, err := getCandidatePubKey()
 	if err != nil {
 		return err
 	}
@@ -125,8 +203,31 @@ func cmdEditCandidacy(cmd *cobra.Command, args []string) error {
 		Details:  viper.GetString(FlagDetails),
 	}
 
-	tx := stake.NewTxEditCandidacy(pk, description)
-	return txcmd.DoTx(tx)
+	edit := stake.TxEditCandidacy{
+		PubKey:      pk,
+		Description: description,
+	}
+	// setting either limit replaces the whole threshold
+	if cmd.Flags().Changed(FlagMinSelfBondRatio) || cmd.Flags().Changed(FlagMaxTotalDelegation) {
+		threshold, err := getThreshold()
+		if err != nil {
+			return err
+		}
+		edit.Threshold = &threshold
+	}
+	return doTx(edit.Wrap())
+}
+
+// getThreshold - the safety threshold set by the flags
+func getThreshold() (threshold stake.SafetyThreshold, err error) {
+	ratio := viper.GetInt64(FlagMinSelfBondRatio)
+	if ratio < 0 {
+		err = fmt.Errorf("--%v cannot be negative", FlagMinSelfBondRatio)
+		return
+	}
+	threshold.MinSelfBondRatio = uint64(ratio)
+	threshold.MaxTotalDelegation = viper.GetInt64(FlagMaxTotalDelegation)
+	return
 }
 
 func cmdDelegate(cmd *cobra.Command, args []string) error {
@@ -141,44 +242,275 @@ func cmdDelegate(cmd *cobra.Command, args []string) error {
 	}
 
 	tx := stake.NewTxDelegate(amount, pk)
-	return txcmd.DoTx(tx)
+	return doTx(tx)
 }
 
 func cmdUnbond(cmd *cobra.Command, args []string) error {
 
+	pk, err := GetPubKey(viper.GetString(FlagPubKey))
+	if err != nil {
+		return err
+	}
+
+	amountStr := viper.GetString(FlagAmount)
+	all := viper.GetBool(FlagAll)
 	sharesRaw := viper.GetInt64(FlagShares)
-	if sharesRaw <= 0 {
-		return fmt.Errorf("shares must be positive interger")
+
+	set := 0
+	for _, isSet := range []bool{amountStr != "", all, sharesRaw != 0} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("use exactly one of --%v, --%v and --%v", FlagAmount, FlagAll, FlagShares)
 	}
-	shares := uint64(sharesRaw)
 
-	pk, err := GetPubKey(viper.GetString(FlagPubKey))
+	delegator, err := getActor()
+	if err != nil {
+		return err
+	}
+
+	var shares uint64
+	switch {
+	case sharesRaw != 0:
+		if sharesRaw < 0 {
+			return fmt.Errorf("shares must be positive interger")
+		}
+		shares = uint64(sharesRaw)
+	case all:
+		shares, err = GetUnbondShares(delegator, pk, nil)
+	default:
+		var amount coin.Coin
+		amount, err = coin.ParseCoin(amountStr)
+		if err != nil {
+			return err
+		}
+		shares, err = GetUnbondShares(delegator, pk, &amount)
+	}
 	if err != nil {
 		return err
 	}
 
 	tx := stake.NewTxUnbond(shares, pk)
+	return doTx(tx)
+}
+
+func cmdRevokeCandidacy(cmd *cobra.Command, args []string) error {
+
+	pk, err := GetPubKey(viper.GetString(FlagPubKey))
+	if err != nil {
+		return err
+	}
+
+	tx := stake.NewTxRevokeCandidacy(pk)
+	return doTx(tx)
+}
+
+func cmdWithdrawPool(cmd *cobra.Command, args []string) error {
+
+	pk, err := GetPubKey(viper.GetString(FlagPubKey))
+	if err != nil {
+		return err
+	}
+
+	tx := stake.NewTxWithdrawPool(pk)
+	return doTx(tx)
+}
+
+func cmdRotateConsensusKey(cmd *cobra.Command, args []string) error {
+
+	pk, err := GetPubKey(viper.GetString(FlagPubKey))
+	if err != nil {
+		return err
+	}
+
+	// the new node's consensus key proves the owner holds it
+	privVal, err := getPrivValidator()
+	if err != nil {
+		return err
+	}
+	owner, err := getActor()
+	if err != nil {
+		return err
+	}
+	signBytes := stake.CandidacySignBytes(commands.GetChainID(), owner)
+	newPubKeySig := privVal.PrivKey.Sign(signBytes)
+
+	tx := stake.NewTxRotateConsensusKey(pk, privVal.PubKey, newPubKeySig)
+	return doTx(tx)
+}
+
+func cmdTransferOwnership(cmd *cobra.Command, args []string) error {
+
+	pk, err := GetPubKey(viper.GetString(FlagPubKey))
+	if err != nil {
+		return err
+	}
+
+	ownerStr := viper.GetString(FlagNewOwner)
+	if ownerStr == "" {
+		return fmt.Errorf("must use --%v flag", FlagNewOwner)
+	}
+	newOwner, err := commands.ParseActor(ownerStr)
+	if err != nil {
+		return err
+	}
+
+	tx := stake.NewTxTransferOwnership(pk, newOwner)
+	return doTx(tx)
+}
+
+// getActor - the actor a stake tx acts for, the --act-as actor if set or
+// else the signer
+func getActor() (sdk.Actor, error) {
+	actAs := viper.GetString(FlagActAs)
+	if actAs == "" {
+		return txcmd.GetSignerAct(), nil
+	}
+	return commands.ParseActor(actAs)
+}
+
+// doTx - send the stake tx, acting for the --act-as actor if set
+func doTx(tx sdk.Tx) error {
+	if actAs := viper.GetString(FlagActAs); actAs != "" {
+		actor, err := commands.ParseActor(actAs)
+		if err != nil {
+			return err
+		}
+		tx = stake.NewTxActAs(actor, tx)
+	}
 	return txcmd.DoTx(tx)
 }
 
-// GetPubKey - create the pubkey from a pubkey string
+// GetUnbondShares - get the number of shares to unbond from the candidate
+// worth the amount of coins, using the candidate's current state. If amount
+// is nil all of the delegator's shares are unbonded.
+func GetUnbondShares(delegator sdk.Actor, pk crypto.PubKey,
+	amount *coin.Coin) (shares uint64, err error) {
+
+	prove := !viper.GetBool(commands.FlagTrustNode)
+
+	if amount == nil {
+		var bond stake.DelegatorBond
+		key := stack.PrefixedKey(stake.Name(), stake.GetDelegatorBondKey(delegator, pk))
+		_, err = query.GetParsed(key, &bond, query.GetHeight(), prove)
+		if client.IsNoDataErr(err) {
+			return 0, fmt.Errorf("no bond from %v to pubkey %v", delegator, pk.KeyString())
+		}
+		return bond.Shares, err
+	}
+
+	if amount.Amount <= 0 {
+		return 0, fmt.Errorf("amount must be positive")
+	}
+
+	var params stake.Params
+	key := stack.PrefixedKey(stake.Name(), stake.ParamKey)
+	_, err = query.GetParsed(key, &params, query.GetHeight(), prove)
+	if err != nil {
+		return 0, err
+	}
+	if amount.Denom != params.AllowedBondDenom {
+		return 0, fmt.Errorf("can only unbond %v coins", params.AllowedBondDenom)
+	}
+
+	var candidate stake.Candidate
+	key = stack.PrefixedKey(stake.Name(), stake.GetCandidateKey(pk))
+	_, err = query.GetParsed(key, &candidate, query.GetHeight(), prove)
+	if client.IsNoDataErr(err) {
+		return 0, fmt.Errorf("no candidate for pubkey %v", pk.KeyString())
+	} else if err != nil {
+		return 0, err
+	}
+
+	return candidate.SharesFromCoins(amount.Amount), nil
+}
+
+// GetPubKey - create the pubkey from a pubkey string. The string may be the
+// hex or base64 encoding of either the raw key bytes or the type-prefixed key
+// bytes, or the JSON form {"type":"ed25519","data":"..."} as found in
+// tendermint's priv_validator.json. The key type is detected from the input.
 func GetPubKey(pubKeyStr string) (pk crypto.PubKey, err error) {
 
+	pubKeyStr = strings.TrimSpace(pubKeyStr)
 	if len(pubKeyStr) == 0 {
 		err = fmt.Errorf("must use --pubkey flag")
 		return
 	}
-	if len(pubKeyStr) != 64 { //if len(pkBytes) != 32 {
-		err = fmt.Errorf("pubkey must be Ed25519 hex encoded string which is 64 characters long")
-		return
+
+	// typed JSON form
+	if strings.HasPrefix(pubKeyStr, "{") {
+		var typed struct {
+			Type string `json:"type"`
+			Data string `json:"data"`
+		}
+		err = json.Unmarshal([]byte(pubKeyStr), &typed)
+		if err != nil {
+			err = fmt.Errorf("invalid pubkey json: %v", err)
+			return
+		}
+		var pkBytes []byte
+		pkBytes, err = decodeKeyBytes(typed.Data)
+		if err != nil {
+			return
+		}
+		return pubKeyFromType(typed.Type, pkBytes)
 	}
-	var pkBytes []byte
-	pkBytes, err = hex.DecodeString(pubKeyStr)
+
+	pkBytes, err := decodeKeyBytes(pubKeyStr)
 	if err != nil {
 		return
 	}
-	var pkEd crypto.PubKeyEd25519
-	copy(pkEd[:], pkBytes[:])
-	pk = pkEd.Wrap()
+	return pubKeyFromBytes(pkBytes)
+}
+
+// decodeKeyBytes decodes hex, falling back to base64
+func decodeKeyBytes(str string) ([]byte, error) {
+	if bz, err := hex.DecodeString(str); err == nil {
+		return bz, nil
+	}
+	if bz, err := base64.StdEncoding.DecodeString(str); err == nil {
+		return bz, nil
+	}
+	return nil, fmt.Errorf("pubkey must be hex or base64 encoded")
+}
+
+// pubKeyFromBytes detects the key type from the length and the leading byte
+func pubKeyFromBytes(bz []byte) (pk crypto.PubKey, err error) {
+	switch {
+	case len(bz) == 32:
+		return pubKeyFromType(crypto.NameEd25519, bz)
+	case len(bz) == 33 && (bz[0] == 0x02 || bz[0] == 0x03): // compressed point
+		return pubKeyFromType(crypto.NameSecp256k1, bz)
+	case len(bz) == 33 && bz[0] == crypto.TypeEd25519,
+		len(bz) == 34 && bz[0] == crypto.TypeSecp256k1:
+		return crypto.PubKeyFromBytes(bz)
+	}
+	err = fmt.Errorf("cannot detect pubkey type from %d bytes", len(bz))
+	return
+}
+
+func pubKeyFromType(keyType string, bz []byte) (pk crypto.PubKey, err error) {
+	switch keyType {
+	case crypto.NameEd25519:
+		var pkEd crypto.PubKeyEd25519
+		if len(bz) != len(pkEd) {
+			err = fmt.Errorf("ed25519 pubkey must be %d bytes, got %d", len(pkEd), len(bz))
+			return
+		}
+		copy(pkEd[:], bz)
+		pk = pkEd.Wrap()
+	case crypto.NameSecp256k1:
+		var pkSecp crypto.PubKeySecp256k1
+		if len(bz) != len(pkSecp) {
+			err = fmt.Errorf("secp256k1 pubkey must be %d bytes, got %d", len(pkSecp), len(bz))
+			return
+		}
+		copy(pkSecp[:], bz)
+		pk = pkSecp.Wrap()
+	default:
+		err = fmt.Errorf("unknown pubkey type %q", keyType)
+	}
 	return
 }
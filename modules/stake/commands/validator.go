@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	crypto "github.com/tendermint/go-crypto"
+	cfg "github.com/tendermint/tendermint/config"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"github.com/tendermint/tmlibs/cli"
+)
+
+// nolint
+const (
+	FlagValidatorHome = "validator-home"
+	FlagPrivValidator = "priv-validator"
+)
+
+// CmdShowValidator - show the consensus pubkey of the local node
+var CmdShowValidator = &cobra.Command{
+	Use:   "show-validator",
+	Short: "Show this node's validator pubkey in the formats accepted by --pubkey",
+	RunE:  cmdShowValidator,
+}
+
+// fsValidator - flags to read the candidate pubkey from a node's files, set
+// up before any init adds them to a command
+var fsValidator = func() *flag.FlagSet {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.String(FlagValidatorHome, "", "Home directory of the validator node to read the pubkey from")
+	fs.String(FlagPrivValidator, "", "Path to the priv_validator.json file to read the pubkey from")
+	return fs
+}()
+
+func cmdShowValidator(cmd *cobra.Command, args []string) error {
+	privVal, err := LoadPrivValidator(privValidatorFile(viper.GetString(cli.HomeFlag)))
+	if err != nil {
+		return err
+	}
+
+	pk := privVal.PubKey
+	typed, err := json.Marshal(pk)
+	if err != nil {
+		return err
+	}
+	raw := pk.Bytes()[1:] // strip the type byte
+
+	fmt.Printf("hex:    %X\n", raw)
+	fmt.Printf("base64: %s\n", base64.StdEncoding.EncodeToString(raw))
+	fmt.Printf("json:   %s\n", typed)
+	return nil
+}
+
+// privValidatorFile - location of the priv_validator file for a node home
+func privValidatorFile(home string) string {
+	return cfg.DefaultConfig().SetRoot(home).PrivValidatorFile()
+}
+
+// LoadPrivValidator - load a priv_validator file without exiting the process
+// on failure as tendermint's loader does
+func LoadPrivValidator(file string) (*tmtypes.PrivValidatorFS, error) {
+	bz, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	privVal := new(tmtypes.PrivValidatorFS)
+	err = json.Unmarshal(bz, privVal)
+	if err != nil {
+		return nil, fmt.Errorf("error reading priv_validator from %v: %v", file, err)
+	}
+	return privVal, nil
+}
+
+// getPrivValidator - load the priv_validator file pointed to by
+// --validator-home or --priv-validator
+func getPrivValidator() (*tmtypes.PrivValidatorFS, error) {
+	home := viper.GetString(FlagValidatorHome)
+	file := viper.GetString(FlagPrivValidator)
+
+	switch {
+	case home != "" && file != "":
+		return nil, fmt.Errorf("use only one of --%v and --%v",
+			FlagValidatorHome, FlagPrivValidator)
+	case home != "":
+		file = privValidatorFile(home)
+	case file == "":
+		return nil, fmt.Errorf("must use --%v or --%v to sign with the validator key",
+			FlagValidatorHome, FlagPrivValidator)
+	}
+	return LoadPrivValidator(file)
+}
+
+// getCandidatePubKey - get the candidate pubkey either from --pubkey or from
+// the priv_validator file pointed to by --validator-home or --priv-validator
+func getCandidatePubKey() (pk crypto.PubKey, err error) {
+	return pubKeyFromFlags(FlagPubKey)
+}
+
+// pubKeyFromFlags - get a pubkey either from the pubkey flag or from the
+// priv_validator file pointed to by --validator-home or --priv-validator
+func pubKeyFromFlags(pkFlag string) (pk crypto.PubKey, err error) {
+	pkStr := viper.GetString(pkFlag)
+	home := viper.GetString(FlagValidatorHome)
+	file := viper.GetString(FlagPrivValidator)
+
+	switch {
+	case pkStr != "" && (home != "" || file != ""),
+		home != "" && file != "":
+		err = fmt.Errorf("use only one of --%v, --%v and --%v",
+			pkFlag, FlagValidatorHome, FlagPrivValidator)
+		return
+	case home != "":
+		file = privValidatorFile(home)
+	case file == "":
+		if pkStr == "" {
+			err = fmt.Errorf("must use --%v flag", pkFlag)
+			return
+		}
+		return GetPubKey(pkStr)
+	}
+
+	privVal, err := LoadPrivValidator(file)
+	if err != nil {
+		return
+	}
+	return privVal.PubKey, nil
+}
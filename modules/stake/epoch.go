@@ -0,0 +1,29 @@
+package stake
+
+// Epoch - a run of Params.EpochLength blocks validated by the same validator
+// set, which is only updated at the end of each epoch
+type Epoch struct {
+	Number       int64 `json:"number"`        // counted from 0 at the first block
+	Length       int64 `json:"length"`        // in blocks
+	UpdateHeight int64 `json:"update_height"` // the last block, which updates the validator set
+}
+
+// GetEpoch - the epoch of the block at the height, under the params. An
+// EpochLength below 1 is taken as 1, updating at every block.
+func GetEpoch(params Params, height int64) Epoch {
+	length := params.EpochLength
+	if length < 1 {
+		length = 1
+	}
+	number := (height - 1) / length
+	return Epoch{
+		Number:       number,
+		Length:       length,
+		UpdateHeight: (number + 1) * length,
+	}
+}
+
+// isEpochEnd - whether the validator set is updated at the height
+func isEpochEnd(params Params, height int64) bool {
+	return GetEpoch(params, height).UpdateHeight == height
+}
@@ -0,0 +1,73 @@
+package stake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cosmos/cosmos-sdk/state"
+)
+
+func TestGetEpoch(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		length, height int64
+		epoch          Epoch
+	}{
+		{1, 1, Epoch{0, 1, 1}},
+		{1, 7, Epoch{6, 1, 7}},
+		{0, 7, Epoch{6, 1, 7}}, // no length updates every block
+		{10, 1, Epoch{0, 10, 10}},
+		{10, 10, Epoch{0, 10, 10}},
+		{10, 11, Epoch{1, 10, 20}},
+		{10, 25, Epoch{2, 10, 30}},
+	}
+	for _, tc := range cases {
+		params := Params{EpochLength: tc.length}
+		assert.Equal(tc.epoch, GetEpoch(params, tc.height), "%v", tc)
+		assert.Equal(tc.height == tc.epoch.UpdateHeight, isEpochEnd(params, tc.height), "%v", tc)
+	}
+}
+
+func TestUpdateValidatorSetEpochs(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	store := state.NewMemKVStore()
+	handler := NewHandler()
+	assert.Error(handler.initState(stakingModuleName, "epoch_length", "0", store))
+	require.NoError(handler.initState(stakingModuleName, "epoch_length", "3", store))
+
+	candidates := candidatesFromActors(newActors(2), []int{400, 100})
+	for _, c := range candidates {
+		c.VotingPower = 0
+		saveCandidate(store, c)
+	}
+
+	// the validators only join at the end of the epoch
+	for height := int64(1); height <= 3; height++ {
+		change, err := UpdateValidatorSet(store, height)
+		require.NoError(err)
+		if height < 3 {
+			assert.Empty(change, "height %d", height)
+		} else {
+			assert.Len(change, 2)
+		}
+	}
+
+	// and later changes wait for the end of the next one, the set carried
+	// over to every block until then
+	candidates[1].Shares = 200
+	saveCandidate(store, candidates[1])
+	for height := int64(4); height <= 6; height++ {
+		change, err := UpdateValidatorSet(store, height)
+		require.NoError(err)
+		if height < 6 {
+			assert.Empty(change, "height %d", height)
+			assert.Contains(loadValidatorSet(store, height+1), ValidatorPower{pks[1], 100})
+		} else {
+			require.Len(change, 1)
+			assert.Equal(int64(200), change[0].Power)
+		}
+	}
+}
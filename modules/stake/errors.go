@@ -9,6 +9,7 @@ import (
 
 var (
 	errCandidateEmpty     = fmt.Errorf("Cannot bond to an empty candidate")
+	errBadPubKeyType      = fmt.Errorf("PubKey type cannot be used by the consensus engine, use ed25519 or secp256k1")
 	errBadBondingDenom    = fmt.Errorf("Invalid coin denomination")
 	errBadBondingAmount   = fmt.Errorf("Amount must be > 0")
 	errNoBondingAcct      = fmt.Errorf("No bond account for this (address, validator) pair")
@@ -23,19 +24,61 @@ var (
 	errNoDelegatorForAddress = fmt.Errorf("Delegator does not contain validator bond")
 	errInsufficientFunds     = fmt.Errorf("Insufficient bond shares")
 	errBadRemoveValidator    = fmt.Errorf("Error removing validator")
+	errBatchEmpty            = fmt.Errorf("Batch must contain at least one transaction")
+	errBadBatchTx            = fmt.Errorf("Batch can only contain delegate, unbond and edit-candidacy transactions")
+	errUnknownPolicy         = fmt.Errorf("Unknown validator selection policy")
+	errUnknownPowerFunction  = fmt.Errorf("Unknown voting power function")
+	errBondTooSmall          = fmt.Errorf("Bond would be smaller than the minimum")
+	errNotOwner              = fmt.Errorf("Only the owner of the candidate can do this")
+	errMissingPubKeySig      = fmt.Errorf("Missing signature by the candidate pubkey")
+	errBadPubKeySig          = fmt.Errorf("Signature by the candidate pubkey does not match the owner and chain")
+	errBadActAsTx            = fmt.Errorf("Can only act as another actor for a stake transaction")
+	errActorNotPermitted     = fmt.Errorf("Transaction is not authorized by the actor")
+	errCrossesThreshold      = fmt.Errorf("Delegation would cross the candidate's safety threshold")
+	errNothingInPool         = fmt.Errorf("No coins of the sender in the candidate's liquid pool")
+	errTooFewValidators      = fmt.Errorf("Candidate is one of the last validators, as of the last update")
+	errPowerCapped           = fmt.Errorf("Candidate's voting power is capped, delegating would add no power")
+	errUnsettledShares       = fmt.Errorf("Candidate has shares which no bond accounts for")
 
 	invalidInput = errors.CodeTypeBaseInvalidInput
 )
 
+func ErrBadPubKeyType() error {
+	return errors.WithCode(errBadPubKeyType, errors.CodeTypeBaseInvalidInput)
+}
 func ErrBadValidatorAddr() error {
 	return errors.WithCode(errBadValidatorAddr, errors.CodeTypeBaseUnknownAddress)
 }
 func ErrCandidateExistsAddr() error {
 	return errors.WithCode(errCandidateExistsAddr, errors.CodeTypeBaseInvalidInput)
 }
+func ErrNotOwner() error {
+	return errors.WithCode(errNotOwner, errors.CodeTypeUnauthorized)
+}
 func ErrMissingSignature() error {
 	return errors.WithCode(errMissingSignature, errors.CodeTypeUnauthorized)
 }
+func ErrMissingPubKeySig() error {
+	return errors.WithCode(errMissingPubKeySig, errors.CodeTypeUnauthorized)
+}
+func ErrBadPubKeySig() error {
+	return errors.WithCode(errBadPubKeySig, errors.CodeTypeUnauthorized)
+}
+func ErrActorNotPermitted(actor string) error {
+	return errors.WithMessage(actor, errActorNotPermitted, errors.CodeTypeUnauthorized)
+}
+func ErrCrossesThreshold() error {
+	return errors.WithCode(errCrossesThreshold, errors.CodeTypeBaseInvalidInput)
+}
+func ErrNothingInPool() error {
+	return errors.WithCode(errNothingInPool, errors.CodeTypeBaseInvalidInput)
+}
+func ErrTooFewValidators(min uint16) error {
+	return errors.WithMessage(fmt.Sprintf("minimum %d", min), errTooFewValidators, errors.CodeTypeBaseInvalidInput)
+}
+func ErrPowerCapped() error {
+	return errors.WithCode(errPowerCapped, errors.CodeTypeBaseInvalidInput)
+}
 func ErrBondNotNominated() error {
 	return errors.WithCode(errBondNotNominated, errors.CodeTypeBaseInvalidOutput)
 }
@@ -51,3 +94,18 @@ func ErrInsufficientFunds() error {
 func ErrBadRemoveValidator() error {
 	return errors.WithCode(errBadRemoveValidator, errors.CodeTypeInternalErr)
 }
+func ErrUnsettledShares(shares uint64) error {
+	return errors.WithMessage(fmt.Sprintf("%d shares", shares), errUnsettledShares, errors.CodeTypeInternalErr)
+}
+func ErrBadBatchTx(index int) error {
+	return errors.WithMessage(fmt.Sprintf("batch tx %d", index), errBadBatchTx, errors.CodeTypeBaseInvalidInput)
+}
+func ErrUnknownSelectionPolicy(name string) error {
+	return errors.WithMessage(name, errUnknownPolicy, errors.CodeTypeBaseInvalidInput)
+}
+func ErrUnknownPowerFunction(name string) error {
+	return errors.WithMessage(name, errUnknownPowerFunction, errors.CodeTypeBaseInvalidInput)
+}
+func ErrBondTooSmall(min int64) error {
+	return errors.WithMessage(fmt.Sprintf("minimum %d", min), errBondTooSmall, errors.CodeTypeBaseInvalidInput)
+}
@@ -30,6 +30,11 @@ type delegatedProofOfStake interface {
 	editCandidacy(TxEditCandidacy) error
 	delegate(TxDelegate) error
 	unbond(TxUnbond) error
+	stakeBatch(TxStakeBatch) error
+	rotateConsensusKey(TxRotateConsensusKey) error
+	transferOwnership(TxTransferOwnership) error
+	revokeCandidacy(TxRevokeCandidacy) error
+	withdrawPool(TxWithdrawPool) error
 }
 
 type coinSend interface {
@@ -74,9 +79,27 @@ func (Handler) initState(module, key, value string, store state.SimpleDB) error
 	switch key {
 	case "allowed_bond_denom":
 		params.AllowedBondDenom = value
+	case "selection_policy":
+		if _, err := GetSelectionPolicy(value); err != nil {
+			return err
+		}
+		params.SelectionPolicy = value
+	case "power_function":
+		if _, err := GetPowerFunction(value); err != nil {
+			return err
+		}
+		params.PowerFunction = value
 	case "max_vals",
+		"min_validators",
+		"max_power_churn",
+		"max_power_fraction",
+		"power_log_knee",
+		"epoch_length",
 		"gas_bond",
-		"gas_unbond":
+		"gas_unbond",
+		"validator_history",
+		"min_self_bond",
+		"min_delegation":
 
 		// TODO: enforce non-negative integers in input
 		i, err := strconv.Atoi(value)
@@ -87,10 +110,50 @@ func (Handler) initState(module, key, value string, store state.SimpleDB) error
 		switch key {
 		case "max_vals":
 			params.MaxVals = uint16(i)
+		case "min_validators":
+			if i < 0 || i > int(params.MaxVals) {
+				return fmt.Errorf("min_validators must be 0 to max_vals %d", params.MaxVals)
+			}
+			params.MinValidators = uint16(i)
+		case "max_power_churn":
+			if i < 0 || i > maxRatio {
+				return fmt.Errorf("max_power_churn must be 0 to %d basis points", maxRatio)
+			}
+			params.MaxPowerChurn = uint64(i)
+		case "max_power_fraction":
+			if i < 0 || i > maxRatio {
+				return fmt.Errorf("max_power_fraction must be 0 to %d basis points", maxRatio)
+			}
+			params.MaxPowerFraction = uint64(i)
+		case "power_log_knee":
+			if i <= 0 {
+				return fmt.Errorf("power_log_knee must be positive")
+			}
+			params.PowerLogKnee = uint64(i)
+		case "epoch_length":
+			if i <= 0 {
+				return fmt.Errorf("epoch_length must be positive")
+			}
+			params.EpochLength = int64(i)
 		case "gas_bond":
 			params.GasDelegate = int64(i)
 		case "gas_unbound":
 			params.GasUnbond = int64(i)
+		case "validator_history":
+			if i < 0 {
+				return fmt.Errorf("validator_history can't be negative, 0 keeps all")
+			}
+			params.ValidatorHistory = int64(i)
+		case "min_self_bond":
+			if i < 0 {
+				return fmt.Errorf("min_self_bond can't be negative")
+			}
+			params.MinSelfBond = int64(i)
+		case "min_delegation":
+			if i < 0 {
+				return fmt.Errorf("min_delegation can't be negative")
+			}
+			params.MinDelegation = int64(i)
 		}
 	default:
 		return errors.ErrUnknownKey(key)
@@ -109,8 +172,8 @@ func (h Handler) CheckTx(ctx sdk.Context, store state.SimpleDB,
 		return res, err
 	}
 
-	// get the sender
-	sender, err := getTxSender(ctx)
+	// get the sender, and the stake tx it sends
+	sender, tx, err := getTxSender(ctx, tx)
 	if err != nil {
 		return res, err
 	}
@@ -119,8 +182,9 @@ func (h Handler) CheckTx(ctx sdk.Context, store state.SimpleDB,
 
 	// create the new checker object to
 	checker := check{
-		store:  store,
-		sender: sender,
+		store:   store,
+		sender:  sender,
+		chainID: ctx.ChainID(),
 	}
 
 	// return the fee for each tx type
@@ -137,6 +201,21 @@ func (h Handler) CheckTx(ctx sdk.Context, store state.SimpleDB,
 	case TxUnbond:
 		return sdk.NewCheck(params.GasUnbond, ""),
 			checker.unbond(txInner)
+	case TxStakeBatch:
+		return sdk.NewCheck(batchGas(params, txInner), ""),
+			checker.stakeBatch(txInner)
+	case TxRotateConsensusKey:
+		return sdk.NewCheck(params.GasRotateConsensusKey, ""),
+			checker.rotateConsensusKey(txInner)
+	case TxTransferOwnership:
+		return sdk.NewCheck(params.GasTransferOwnership, ""),
+			checker.transferOwnership(txInner)
+	case TxRevokeCandidacy:
+		return sdk.NewCheck(revokeGas(store, params, txInner), ""),
+			checker.revokeCandidacy(txInner)
+	case TxWithdrawPool:
+		return sdk.NewCheck(params.GasWithdrawPool, ""),
+			checker.withdrawPool(txInner)
 	}
 
 	return res, errors.ErrUnknownTxType(tx)
@@ -153,34 +232,37 @@ func (h Handler) DeliverTx(ctx sdk.Context, store state.SimpleDB,
 		return
 	}
 
-	sender, err := getTxSender(ctx)
+	sender, tx, err := getTxSender(ctx, tx)
 	if err != nil {
 		return
 	}
 
 	params := loadParams(store)
+	tags := new(txTags)
 	deliverer := deliver{
 		store:  store,
 		sender: sender,
+		height: ctx.BlockHeight(),
 		params: params,
 		transfer: coinSender{
 			store:    store,
 			dispatch: dispatch,
 			ctx:      ctx,
 		}.transferFn,
+		tags: tags,
 	}
 
 	// Run the transaction
 	switch _tx := tx.Unwrap().(type) {
 	case TxDeclareCandidacy:
 		res.GasUsed = params.GasDeclareCandidacy
-		return res, deliverer.declareCandidacy(_tx)
+		err = deliverer.declareCandidacy(_tx)
 	case TxEditCandidacy:
 		res.GasUsed = params.GasEditCandidacy
-		return res, deliverer.editCandidacy(_tx)
+		err = deliverer.editCandidacy(_tx)
 	case TxDelegate:
 		res.GasUsed = params.GasDelegate
-		return res, deliverer.delegate(_tx)
+		err = deliverer.delegate(_tx)
 	case TxUnbond:
 		//context with hold account permissions
 		params := loadParams(store)
@@ -191,18 +273,119 @@ func (h Handler) DeliverTx(ctx sdk.Context, store state.SimpleDB,
 			dispatch: dispatch,
 			ctx:      ctx2,
 		}.transferFn
-		return res, deliverer.unbond(_tx)
+		err = deliverer.unbond(_tx)
+	case TxStakeBatch:
+		// the batch may unbond so needs the hold account permissions, and
+		// runs on a checkpoint which is only committed if every tx succeeds
+		res.GasUsed = batchGas(params, _tx)
+		cache := store.Checkpoint()
+		deliverer.store = cache
+		deliverer.transfer = coinSender{
+			store:    cache,
+			dispatch: dispatch,
+			ctx:      ctx.WithPermissions(params.HoldAccount),
+		}.transferFn
+		err = deliverer.stakeBatch(_tx)
+		if err != nil {
+			cache.Discard()
+			return
+		}
+		err = store.Commit(cache)
+	case TxRotateConsensusKey:
+		res.GasUsed = params.GasRotateConsensusKey
+		err = deliverer.rotateConsensusKey(_tx)
+	case TxTransferOwnership:
+		res.GasUsed = params.GasTransferOwnership
+		err = deliverer.transferOwnership(_tx)
+	case TxRevokeCandidacy:
+		// every bond is unbonded, so this needs the hold account permissions
+		// and runs on a checkpoint which is only committed if all succeed
+		res.GasUsed = revokeGas(store, params, _tx)
+		cache := store.Checkpoint()
+		deliverer.store = cache
+		deliverer.transfer = coinSender{
+			store:    cache,
+			dispatch: dispatch,
+			ctx:      ctx.WithPermissions(params.HoldAccount),
+		}.transferFn
+		err = deliverer.revokeCandidacy(_tx)
+		if err != nil {
+			cache.Discard()
+			return
+		}
+		err = store.Commit(cache)
+	case TxWithdrawPool:
+		// the pooled coins are in the hold account
+		res.GasUsed = params.GasWithdrawPool
+		deliverer.transfer = coinSender{
+			store:    store,
+			dispatch: dispatch,
+			ctx:      ctx.WithPermissions(params.HoldAccount),
+		}.transferFn
+		err = deliverer.withdrawPool(_tx)
+	}
+	if err != nil {
+		return
+	}
+
+	res.Tags = tags.pairs
+	return
+}
+
+// batchGas - the summed gas of all the txs in the batch
+func batchGas(params Params, tx TxStakeBatch) (gas int64) {
+	for _, inner := range tx.Txs {
+		switch inner.Unwrap().(type) {
+		case TxEditCandidacy:
+			gas += params.GasEditCandidacy
+		case TxDelegate:
+			gas += params.GasDelegate
+		case TxUnbond:
+			gas += params.GasUnbond
+		}
 	}
 	return
 }
 
-// get the sender from the ctx and ensure it matches the tx pubkey
-func getTxSender(ctx sdk.Context) (sender sdk.Actor, err error) {
+// revokeGas - the gas to revoke the candidacy, which unbonds every delegator
+// and withdraws every entry of the liquid pool
+func revokeGas(store state.SimpleDB, params Params, tx TxRevokeCandidacy) int64 {
+	gas := params.GasRevokeCandidacy
+	gas += params.GasUnbond * loadDelegatorsCount(store, tx.PubKey)
+	if pool := loadLiquidPool(store, tx.PubKey); pool != nil {
+		gas += params.GasWithdrawPool * int64(len(pool.Entries))
+	}
+	return gas
+}
+
+// runBatchTx - run one tx of a batch against the checker or deliverer
+func runBatchTx(dpos delegatedProofOfStake, tx sdk.Tx) error {
+	switch txInner := tx.Unwrap().(type) {
+	case TxEditCandidacy:
+		return dpos.editCandidacy(txInner)
+	case TxDelegate:
+		return dpos.delegate(txInner)
+	case TxUnbond:
+		return dpos.unbond(txInner)
+	}
+	return errors.ErrUnknownTxType(tx)
+}
+
+// get the actor the tx acts for along with the stake tx to run, that is the
+// tx's single signer, or the actor named by a TxActAs if it is permitted
+func getTxSender(ctx sdk.Context, tx sdk.Tx) (sender sdk.Actor, inner sdk.Tx, err error) {
+	if actAs, ok := tx.Unwrap().(TxActAs); ok {
+		if !ctx.HasPermission(actAs.Actor) {
+			return sender, inner, ErrActorNotPermitted(actAs.Actor.String())
+		}
+		return actAs.Actor, actAs.Tx, nil
+	}
+
 	senders := ctx.GetPermissions("", auth.NameSigs)
 	if len(senders) != 1 {
-		return sender, ErrMissingSignature()
+		return sender, inner, ErrMissingSignature()
 	}
-	return senders[0], nil
+	return senders[0], tx, nil
 }
 
 //_______________________________________________________________________
@@ -226,14 +409,21 @@ func (c coinSender) transferFn(sender, receiver sdk.Actor, coins coin.Coins) err
 //_____________________________________________________________________
 
 type check struct {
-	store  state.SimpleDB
-	sender sdk.Actor
+	store   state.SimpleDB
+	sender  sdk.Actor
+	chainID string
 }
 
 var _ delegatedProofOfStake = check{} // enforce interface at compile time
 
 func (c check) declareCandidacy(tx TxDeclareCandidacy) error {
 
+	// the sender must hold the consensus key, or anyone could squat it
+	signBytes := CandidacySignBytes(c.chainID, c.sender)
+	if !tx.PubKey.VerifyBytes(signBytes, tx.PubKeySig) {
+		return ErrBadPubKeySig()
+	}
+
 	// check to see if the pubkey or sender has been registered before
 	candidate := loadCandidate(c.store, tx.PubKey)
 	if candidate != nil {
@@ -242,6 +432,14 @@ func (c check) declareCandidacy(tx TxDeclareCandidacy) error {
 			candidate.PubKey, candidate.Owner)
 	}
 
+	if min := loadParams(c.store).MinSelfBond; tx.Bond.Amount < min {
+		return ErrBondTooSmall(min)
+	}
+	declared := Candidate{Threshold: tx.Threshold}
+	shares := declared.SharesFromCoins(tx.Bond.Amount)
+	if declared.crossesThreshold(shares, shares) {
+		return ErrCrossesThreshold()
+	}
 	return checkDenom(tx.BondUpdate, c.store)
 }
 
@@ -261,6 +459,39 @@ func (c check) delegate(tx TxDelegate) error {
 	if candidate == nil { // does PubKey exist
 		return fmt.Errorf("cannot delegate to non-existant PubKey %v", tx.PubKey)
 	}
+
+	// the bond after the delegation can't be dust
+	delegated := candidate.SharesFromCoins(tx.Bond.Amount)
+	shares := delegated
+	if bond := loadDelegatorBond(c.store, c.sender, tx.PubKey); bond != nil {
+		shares += bond.Shares
+	}
+	if err := checkMinBond(c.store, candidate, c.sender, shares); err != nil {
+		return err
+	}
+
+	// nor only add power clipped by the cap, though the owner may always bond
+	// more to their own candidate
+	if !c.sender.Equals(candidate.Owner) {
+		capped, err := addsNoPower(c.store, candidate, delegated)
+		if err != nil {
+			return err
+		}
+		if capped {
+			return ErrPowerCapped()
+		}
+	}
+
+	// nor take the candidate beyond its safety threshold, though the owner
+	// bonding more only ever helps the self-bond ratio
+	shares = candidate.Shares + delegated
+	selfShares := candidate.selfShares(c.store)
+	if c.sender.Equals(candidate.Owner) {
+		selfShares = shares
+	}
+	if candidate.crossesThreshold(shares, selfShares) {
+		return ErrCrossesThreshold()
+	}
 	return checkDenom(tx.BondUpdate, c.store)
 }
 
@@ -268,13 +499,150 @@ func (c check) unbond(tx TxUnbond) error {
 
 	// check if have enough shares to unbond
 	bond := loadDelegatorBond(c.store, c.sender, tx.PubKey)
+	if bond == nil {
+		return ErrNoDelegatorForAddress()
+	}
 	if bond.Shares < tx.Shares {
 		return fmt.Errorf("not enough bond shares to unbond, have %v, trying to unbond %v",
 			bond.Shares, tx.Shares)
 	}
+
+	// a partial unbond can't leave dust, unbonding everything is always fine
+	candidate := loadCandidate(c.store, tx.PubKey)
+	if candidate != nil && bond.Shares > tx.Shares {
+		return checkMinBond(c.store, candidate, c.sender, bond.Shares-tx.Shares)
+	}
+
+	// unless it removes a validator the chain can't do without
+	if candidate != nil && candidate.Shares == tx.Shares {
+		return checkMinValidators(c.store, candidate)
+	}
+	return nil
+}
+
+// checkMinValidators - the candidate can only stop validating if more than
+// Params.MinValidators candidates validated at the last update. This only
+// turns away the obvious cases, the txs of a block are checked against the
+// same count, UpdateValidatorSet is what keeps the minimum.
+func checkMinValidators(store state.SimpleDB, candidate *Candidate) error {
+	if candidate.VotingPower == 0 {
+		return nil
+	}
+	min := loadParams(store).MinValidators
+	if len(loadCandidates(store).Validators()) <= int(min) {
+		return ErrTooFewValidators(min)
+	}
+	return nil
+}
+
+// stakeBatch checks every tx against the state left behind by the txs before
+// it, by running the batch on a throwaway copy of the store
+func (c check) stakeBatch(tx TxStakeBatch) error {
+	cache := c.store.Checkpoint()
+	defer cache.Discard()
+
+	checker := check{
+		store:   cache,
+		sender:  c.sender,
+		chainID: c.chainID,
+	}
+	// coin balances are checked when the transfers are delivered
+	simulator := deliver{
+		store:    cache,
+		sender:   c.sender,
+		params:   loadParams(cache),
+		transfer: func(_, _ sdk.Actor, _ coin.Coins) error { return nil },
+	}
+
+	for i, inner := range tx.Txs {
+		if err := runBatchTx(checker, inner); err != nil {
+			return fmt.Errorf("batch tx %d: %v", i, err)
+		}
+		if err := runBatchTx(simulator, inner); err != nil {
+			return fmt.Errorf("batch tx %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// checkMinBond - a bond of the shares must be worth at least the
+// Params.MinSelfBond for the candidate's owner, or Params.MinDelegation for
+// any other delegator
+func checkMinBond(store state.SimpleDB, candidate *Candidate,
+	delegator sdk.Actor, shares uint64) error {
+
+	params := loadParams(store)
+	min := params.MinDelegation
+	if delegator.Equals(candidate.Owner) {
+		min = params.MinSelfBond
+	}
+	if candidate.CoinsFromShares(shares) < min {
+		return ErrBondTooSmall(min)
+	}
+	return nil
+}
+
+func (c check) rotateConsensusKey(tx TxRotateConsensusKey) error {
+
+	// the owner must hold the new consensus key, or could squat it
+	signBytes := CandidacySignBytes(c.chainID, c.sender)
+	if !tx.NewPubKey.VerifyBytes(signBytes, tx.NewPubKeySig) {
+		return ErrBadPubKeySig()
+	}
+
+	candidate := loadCandidate(c.store, tx.PubKey)
+	if candidate == nil {
+		return ErrNoCandidateForAddress()
+	}
+	if candidate.Owner.Empty() || !candidate.Owner.Equals(c.sender) {
+		return ErrNotOwner()
+	}
+	if loadCandidate(c.store, tx.NewPubKey) != nil {
+		return ErrCandidateExistsAddr()
+	}
+	return nil
+}
+
+func (c check) transferOwnership(tx TxTransferOwnership) error {
+
+	candidate := loadCandidate(c.store, tx.PubKey)
+	if candidate == nil {
+		return ErrNoCandidateForAddress()
+	}
+	if candidate.Owner.Empty() || !candidate.Owner.Equals(c.sender) {
+		return ErrNotOwner()
+	}
+	if tx.NewOwner.Equals(candidate.Owner) {
+		return fmt.Errorf("%v already owns the candidate", tx.NewOwner)
+	}
 	return nil
 }
 
+func (c check) revokeCandidacy(tx TxRevokeCandidacy) error {
+
+	candidate := loadCandidate(c.store, tx.PubKey)
+	if candidate == nil {
+		return ErrNoCandidateForAddress()
+	}
+	if candidate.Owner.Empty() || !candidate.Owner.Equals(c.sender) {
+		return ErrNotOwner()
+	}
+	return checkMinValidators(c.store, candidate)
+}
+
+func (c check) withdrawPool(tx TxWithdrawPool) error {
+	pool := loadLiquidPool(c.store, tx.PubKey)
+	if pool == nil {
+		return ErrNothingInPool()
+	}
+	for _, e := range pool.Entries {
+		if e.Delegator.Equals(c.sender) {
+			return nil
+		}
+	}
+	return ErrNothingInPool()
+}
+
 func checkDenom(tx BondUpdate, store state.SimpleDB) error {
 	if tx.Bond.Denom != loadParams(store).AllowedBondDenom {
 		return fmt.Errorf("Invalid coin denomination")
@@ -287,8 +655,10 @@ func checkDenom(tx BondUpdate, store state.SimpleDB) error {
 type deliver struct {
 	store    state.SimpleDB
 	sender   sdk.Actor
+	height   int64
 	params   Params
 	transfer transferFn
+	tags     *txTags
 }
 
 type transferFn func(sender, receiver sdk.Actor, coins coin.Coins) error
@@ -305,8 +675,11 @@ func (d deliver) declareCandidacy(tx TxDeclareCandidacy) error {
 		return ErrCandidateExistsAddr()
 	}
 	candidate := NewCandidate(tx.PubKey, d.sender)
+	candidate.DeclareHeight = d.height
 	candidate.Description = tx.Description // add the description parameters
+	candidate.Threshold = tx.Threshold
 	saveCandidate(d.store, candidate)
+	d.tags.add(ActionDeclareCandidacy, d.sender, tx.PubKey, coin.Coin{}, 0)
 
 	// move coins from the d.sender account to a (self-bond) delegator account
 	// the candidate account will be updated automatically here
@@ -338,8 +711,12 @@ func (d deliver) editCandidacy(tx TxEditCandidacy) error {
 	if tx.Description.Details != "" {
 		candidate.Description.Details = tx.Description.Details
 	}
+	if tx.Threshold != nil {
+		candidate.Threshold = *tx.Threshold
+	}
 
 	saveCandidate(d.store, candidate)
+	d.tags.add(ActionEditCandidacy, d.sender, tx.PubKey, coin.Coin{}, 0)
 	return nil
 }
 
@@ -374,14 +751,16 @@ func (d deliver) delegate(tx TxDelegate) error {
 	}
 
 	// Add shares to delegator bond and candidate
-	bondAmount := uint64(tx.Bond.Amount) // XXX: checked for underflow in ValidateBasic
-	bond.Shares += bondAmount
-	candidate.Shares += bondAmount
+	// XXX: amount checked for underflow in ValidateBasic
+	bondShares := candidate.SharesFromCoins(tx.Bond.Amount)
+	bond.Shares += bondShares
+	candidate.Shares += bondShares
 
 	// Save to d.store
 	saveCandidate(d.store, candidate)
 	saveDelegatorBond(d.store, d.sender, bond)
 
+	d.tags.add(ActionDelegate, d.sender, tx.PubKey, tx.Bond, bondShares)
 	return nil
 }
 
@@ -419,7 +798,8 @@ func (d deliver) unbond(tx TxUnbond) error {
 		saveDelegatorBond(d.store, d.sender, bond)
 	}
 
-	// deduct shares from the candidate
+	// deduct shares from the candidate, valuing them before they're removed
+	returnCoins := candidate.CoinsFromShares(tx.Shares) // XXX: watch overflow
 	candidate.Shares -= tx.Shares
 	if candidate.Shares == 0 {
 		removeCandidate(d.store, tx.PubKey)
@@ -428,8 +808,155 @@ func (d deliver) unbond(tx TxUnbond) error {
 	}
 
 	// transfer coins back to account
-	txShares := int64(tx.Shares) // XXX: watch overflow
-	returnCoins := txShares      //currently each share is worth one coin
-	return d.transfer(d.params.HoldAccount, d.sender,
-		coin.Coins{{d.params.AllowedBondDenom, returnCoins}})
+	returned := coin.Coin{d.params.AllowedBondDenom, returnCoins}
+	err := d.transfer(d.params.HoldAccount, d.sender, coin.Coins{returned})
+	if err != nil {
+		return err
+	}
+
+	d.tags.add(ActionUnbond, d.sender, tx.PubKey, returned, tx.Shares)
+	return nil
+}
+
+// stakeBatch applies the txs in order, the caller is responsible for
+// discarding the changes of a batch which fails part way through
+func (d deliver) stakeBatch(tx TxStakeBatch) error {
+	for i, inner := range tx.Txs {
+		if err := runBatchTx(d, inner); err != nil {
+			return fmt.Errorf("batch tx %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// rotateConsensusKey moves the candidate and every bond to it to the new
+// pubkey. The rotation is recorded so that the next validator set update
+// removes the old pubkey and adds the new one with its power at once.
+func (d deliver) rotateConsensusKey(tx TxRotateConsensusKey) error {
+
+	candidate := loadCandidate(d.store, tx.PubKey)
+	if candidate == nil {
+		return ErrNoCandidateForAddress()
+	}
+
+	// move the bonds, which also moves the delegators lists
+	for _, delegator := range loadCandidateDelegators(d.store, tx.PubKey) {
+		bond := loadDelegatorBond(d.store, delegator, tx.PubKey)
+		removeDelegatorBond(d.store, delegator, tx.PubKey)
+		bond.PubKey = tx.NewPubKey
+		saveDelegatorBond(d.store, delegator, bond)
+	}
+
+	// the liquid pool, to be bonded to the new pubkey once it validates
+	if pool := loadLiquidPool(d.store, tx.PubKey); pool != nil {
+		d.store.Remove(GetLiquidPoolKey(tx.PubKey))
+		pool.PubKey = tx.NewPubKey
+		saveLiquidPool(d.store, pool)
+	}
+
+	// and the candidate itself
+	removeCandidate(d.store, tx.PubKey)
+	candidate.PubKey = tx.NewPubKey
+	saveCandidate(d.store, candidate)
+	addKeyRotation(d.store, tx.PubKey, tx.NewPubKey)
+
+	d.tags.add(ActionRotateConsensusKey, d.sender, tx.PubKey, coin.Coin{}, 0)
+	d.tags.addNewCandidate(tx.NewPubKey)
+	return nil
+}
+
+// transferOwnership hands the candidate to the new owner, along with the self
+// bond, which is added to any bond the new owner already has to the candidate
+func (d deliver) transferOwnership(tx TxTransferOwnership) error {
+
+	candidate := loadCandidate(d.store, tx.PubKey)
+	if candidate == nil {
+		return ErrNoCandidateForAddress()
+	}
+
+	if selfBond := loadDelegatorBond(d.store, candidate.Owner, tx.PubKey); selfBond != nil {
+		removeDelegatorBond(d.store, candidate.Owner, tx.PubKey)
+		bond := loadDelegatorBond(d.store, tx.NewOwner, tx.PubKey)
+		if bond == nil {
+			bond = &DelegatorBond{
+				PubKey: tx.PubKey,
+				Shares: 0,
+			}
+		}
+		bond.Shares += selfBond.Shares
+		saveDelegatorBond(d.store, tx.NewOwner, bond)
+	}
+
+	candidate.Owner = tx.NewOwner
+	saveCandidate(d.store, candidate)
+
+	d.tags.add(ActionTransferOwnership, d.sender, tx.PubKey, coin.Coin{}, 0)
+	d.tags.addNewOwner(tx.NewOwner)
+	return nil
+}
+
+// revokeCandidacy unbonds every delegator of the candidate, the owner
+// included, returning their coins along with any in the candidate's liquid
+// pool. Unbonding the last shares removes the candidate, which leaves the
+// validator set at the next update.
+func (d deliver) revokeCandidacy(tx TxRevokeCandidacy) error {
+
+	candidate := loadCandidate(d.store, tx.PubKey)
+	if candidate == nil {
+		return ErrNoCandidateForAddress()
+	}
+	d.tags.add(ActionRevokeCandidacy, d.sender, tx.PubKey, coin.Coin{}, 0)
+
+	for _, delegator := range loadCandidateDelegators(d.store, tx.PubKey) {
+		bond := loadDelegatorBond(d.store, delegator, tx.PubKey)
+		unbonder := d
+		unbonder.sender = delegator
+		err := unbonder.unbond(TxUnbond{PubKey: tx.PubKey, Shares: bond.Shares})
+		if err != nil {
+			return err
+		}
+	}
+	if pool := loadLiquidPool(d.store, tx.PubKey); pool != nil {
+		for _, e := range pool.Entries {
+			withdrawer := d
+			withdrawer.sender = e.Delegator
+			err := withdrawer.withdrawPool(TxWithdrawPool{PubKey: tx.PubKey})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// shares without a bond can't be returned to anybody, the candidacy is
+	// only revoked once they're all settled
+	if candidate := loadCandidate(d.store, tx.PubKey); candidate != nil {
+		if candidate.Shares > 0 {
+			return ErrUnsettledShares(candidate.Shares)
+		}
+		removeCandidate(d.store, tx.PubKey)
+	}
+	return nil
+}
+
+// withdrawPool returns the sender's coins in the candidate's liquid pool
+func (d deliver) withdrawPool(tx TxWithdrawPool) error {
+
+	pool := loadLiquidPool(d.store, tx.PubKey)
+	if pool == nil {
+		return ErrNothingInPool()
+	}
+	amount := pool.remove(d.sender)
+	if amount == 0 {
+		return ErrNothingInPool()
+	}
+	saveLiquidPool(d.store, pool)
+
+	returned := coin.Coin{d.params.AllowedBondDenom, amount}
+	err := d.transfer(d.params.HoldAccount, d.sender, coin.Coins{returned})
+	if err != nil {
+		return err
+	}
+
+	d.tags.add(ActionWithdrawPool, d.sender, tx.PubKey, returned, 0)
+	return nil
 }
@@ -2,15 +2,19 @@ package stake
 
 import (
 	"encoding/hex"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	abci "github.com/tendermint/abci/types"
 	crypto "github.com/tendermint/go-crypto"
 
 	sdk "github.com/cosmos/cosmos-sdk"
+	"github.com/cosmos/cosmos-sdk/modules/auth"
 	"github.com/cosmos/cosmos-sdk/modules/coin"
+	"github.com/cosmos/cosmos-sdk/stack"
 	"github.com/cosmos/cosmos-sdk/state"
 )
 
@@ -28,6 +32,59 @@ func (c testCoinSender) transferFn(sender, receiver sdk.Actor, coins coin.Coins)
 	return nil
 }
 
+// testCoinDispatch stands in for the coin module, with the balances kept in
+// the store passed to it
+var testCoinDispatch = sdk.DeliverFunc(func(ctx sdk.Context, store state.SimpleDB,
+	tx sdk.Tx) (res sdk.DeliverResult, err error) {
+
+	send := tx.Unwrap().(coin.SendTx)
+	for _, in := range send.Inputs {
+		if _, err = coin.ChangeCoins(store, in.Address, in.Coins.Negative()); err != nil {
+			return
+		}
+	}
+	for _, out := range send.Outputs {
+		if _, err = coin.ChangeCoins(store, out.Address, out.Coins); err != nil {
+			return
+		}
+	}
+	return
+})
+
+// testApp - a stake handler on an in-memory store, which also holds the
+// coins of the accounts for testCoinDispatch
+type testApp struct {
+	t       *testing.T
+	handler Handler
+	store   state.SimpleDB
+}
+
+// newTestApp - a testApp where each of the accounts has 1000 fermions
+func newTestApp(t *testing.T, accounts ...sdk.Actor) testApp {
+	app := testApp{t, NewHandler(), state.NewMemKVStore()}
+	for _, account := range accounts {
+		_, err := coin.ChangeCoins(app.store, account, coin.Coins{{"fermion", 1000}})
+		require.NoError(t, err)
+	}
+	return app
+}
+
+// deliverTx - deliver the tx with the permissions of the signers
+func (app testApp) deliverTx(tx sdk.Tx, signers ...sdk.Actor) (sdk.DeliverResult, error) {
+	ctx := stack.MockContext("testChain", 1).WithPermissions(signers...)
+	return app.handler.DeliverTx(ctx, app.store, tx, testCoinDispatch)
+}
+
+// balance - the fermions of the account
+func (app testApp) balance(account sdk.Actor) int64 {
+	acc, err := coin.GetAccount(app.store, account)
+	require.NoError(app.t, err)
+	if len(acc.Coins) == 0 {
+		return 0
+	}
+	return acc.Coins[0].Amount
+}
+
 //______________________________________________________________________
 
 func initAccounts(n int, amount int64) ([]sdk.Actor, map[string]int64) {
@@ -41,11 +98,10 @@ func initAccounts(n int, amount int64) ([]sdk.Actor, map[string]int64) {
 
 func newTxDeclareCandidacy(amt int64, pubKey crypto.PubKey) TxDeclareCandidacy {
 	return TxDeclareCandidacy{
-		BondUpdate{
+		BondUpdate: BondUpdate{
 			PubKey: pubKey,
 			Bond:   coin.Coin{"fermion", amt},
 		},
-		Description{},
 	}
 }
 
@@ -80,11 +136,35 @@ func newPubKey(pk string) crypto.PubKey {
 	return pkEd.Wrap()
 }
 
+// testPrivKeys - the private keys of the test pubkeys which can sign, by
+// pubkey
+var testPrivKeys = map[string]crypto.PrivKey{}
+
+func newPrivPubKey(secret string) crypto.PubKey {
+	privKey := crypto.GenPrivKeyEd25519FromSecret([]byte(secret)).Wrap()
+	testPrivKeys[privKey.PubKey().KeyString()] = privKey
+	return privKey.PubKey()
+}
+
+// signCandidacy - sign the declaration for the owner on the chain with the
+// private key of the test pubkey
+func signCandidacy(tx TxDeclareCandidacy, chainID string, owner sdk.Actor) TxDeclareCandidacy {
+	tx.PubKeySig = testPrivKeys[tx.PubKey.KeyString()].Sign(CandidacySignBytes(chainID, owner))
+	return tx
+}
+
+// signRotation - sign the rotation for the owner on the chain with the new
+// consensus key
+func signRotation(tx TxRotateConsensusKey, chainID string, owner sdk.Actor) TxRotateConsensusKey {
+	tx.NewPubKeySig = testPrivKeys[tx.NewPubKey.KeyString()].Sign(CandidacySignBytes(chainID, owner))
+	return tx
+}
+
 //dummy public keys used for testing
 var (
-	pk1 = newPubKey("0B485CFC0EECC619440448436F8FC9DF40566F2369E72400281454CB552AFB57")
-	pk2 = newPubKey("E2CB355FD7965D70627AB279016D713CAF82612216D833372187520E264C3588")
-	pk3 = newPubKey("03E6F86BC3B9BDF9E6FEAB434BE1A3A2817BF4AE15CE0D4054C6EA7BFC2A30BE")
+	pk1 = newPrivPubKey("pk1")
+	pk2 = newPrivPubKey("pk2")
+	pk3 = newPrivPubKey("pk3")
 )
 
 func TestDuplicatesTxDeclareCandidacy(t *testing.T) {
@@ -103,16 +183,39 @@ func TestDuplicatesTxDeclareCandidacy(t *testing.T) {
 
 	// one sender can bond to two different pubKeys
 	txDeclareCandidacy.PubKey = pk2
-	err := checker.declareCandidacy(txDeclareCandidacy)
+	err := checker.declareCandidacy(signCandidacy(txDeclareCandidacy, "", senders[0]))
 	assert.Nil(err, "didn't expected error on checkTx")
 
 	// two senders cant bond to the same pubkey
 	checker.sender = senders[1]
 	txDeclareCandidacy.PubKey = pk1
-	err = checker.declareCandidacy(txDeclareCandidacy)
+	err = checker.declareCandidacy(signCandidacy(txDeclareCandidacy, "", senders[1]))
 	assert.NotNil(err, "expected error on checkTx")
 }
 
+func TestTxDeclareCandidacyPubKeySig(t *testing.T) {
+	assert := assert.New(t)
+	senders, _ := initAccounts(2, 1000)
+	checker := check{
+		store:   state.NewMemKVStore(),
+		sender:  senders[0],
+		chainID: "testChain",
+	}
+	tx := newTxDeclareCandidacy(10, pk1)
+
+	// the signature must be present
+	assert.Error(tx.ValidateBasic())
+	assert.Error(checker.declareCandidacy(tx))
+
+	// and by the pubkey over this owner and chain
+	assert.NoError(checker.declareCandidacy(signCandidacy(tx, "testChain", senders[0])))
+	assert.Error(checker.declareCandidacy(signCandidacy(tx, "testChain", senders[1])))
+	assert.Error(checker.declareCandidacy(signCandidacy(tx, "otherChain", senders[0])))
+	squat := signCandidacy(tx, "testChain", senders[0])
+	squat.PubKeySig = signCandidacy(newTxDeclareCandidacy(10, pk2), "testChain", senders[0]).PubKeySig
+	assert.Error(checker.declareCandidacy(squat))
+}
+
 func TestIncrementsTxDelegate(t *testing.T) {
 	assert := assert.New(t)
 	initSender := int64(1000)
@@ -323,3 +426,567 @@ func TestVoidCandidacy(t *testing.T) {
 	assert.NoError(got, "expected ok, got %v", got)
 
 }
+
+func TestTxStakeBatch(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	accounts, accStore := initAccounts(2, 1000)
+	sender, delegator := accounts[0], accounts[1]
+	deliverer := newDeliver(sender, accStore)
+
+	// make two candidates
+	require.NoError(deliverer.declareCandidacy(newTxDeclareCandidacy(10, pk1)))
+	require.NoError(deliverer.declareCandidacy(newTxDeclareCandidacy(10, pk2)))
+
+	// move the delegation from one candidate to the other, the unbond is only
+	// valid after the delegate before it
+	deliverer.sender = delegator
+	checker := check{
+		store:  deliverer.store,
+		sender: delegator,
+	}
+	batch := TxStakeBatch{[]sdk.Tx{
+		newTxDelegate(100, pk1).Wrap(),
+		newTxUnbond(40, pk1).Wrap(),
+		newTxDelegate(40, pk2).Wrap(),
+	}}
+	assert.Error(checker.unbond(newTxUnbond(40, pk1)))
+	require.NoError(checker.stakeBatch(batch))
+
+	// checking doesn't change anything
+	assert.Nil(loadDelegatorBond(deliverer.store, delegator, pk1))
+	assert.Equal(int64(1000), accStore[string(delegator.Address)])
+
+	require.NoError(deliverer.stakeBatch(batch))
+	assert.Equal(uint64(60), loadDelegatorBond(deliverer.store, delegator, pk1).Shares)
+	assert.Equal(uint64(40), loadDelegatorBond(deliverer.store, delegator, pk2).Shares)
+	assert.Equal(int64(900), accStore[string(delegator.Address)])
+
+	// a batch with an invalid tx is rejected in check
+	batch = TxStakeBatch{[]sdk.Tx{
+		newTxDelegate(10, pk1).Wrap(),
+		newTxUnbond(10, pk3).Wrap(),
+	}}
+	assert.Error(checker.stakeBatch(batch))
+}
+
+func TestDeliverTxStakeBatchAtomic(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	sender := auth.SigPerm([]byte("sender"))
+	app := newTestApp(t, sender)
+	store := app.store
+	params := loadParams(store)
+
+	declare := signCandidacy(newTxDeclareCandidacy(100, pk1), "testChain", sender)
+	_, err := app.deliverTx(declare.Wrap(), sender)
+	require.NoError(err)
+	require.Equal(int64(900), app.balance(sender))
+
+	// the second delegate can't be paid for, so neither is applied
+	batch := NewTxStakeBatch([]sdk.Tx{
+		newTxDelegate(500, pk1).Wrap(),
+		newTxDelegate(500, pk1).Wrap(),
+	})
+	_, err = app.deliverTx(batch, sender)
+	assert.Error(err)
+	assert.Equal(int64(900), app.balance(sender))
+	assert.Equal(uint64(100), loadCandidate(store, pk1).Shares)
+
+	// a batch which can be paid for is applied in full, charging the summed gas
+	batch = NewTxStakeBatch([]sdk.Tx{
+		newTxDelegate(500, pk1).Wrap(),
+		newTxUnbond(200, pk1).Wrap(),
+	})
+	res, err := app.deliverTx(batch, sender)
+	require.NoError(err)
+	assert.Equal(params.GasDelegate+params.GasUnbond, res.GasUsed)
+	assert.Equal(int64(600), app.balance(sender))
+	assert.Equal(uint64(400), loadCandidate(store, pk1).Shares)
+}
+
+func TestDeliverTxTags(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	sender := auth.SigPerm([]byte("sender"))
+	app := newTestApp(t, sender)
+
+	tags := func(tx sdk.Tx) map[string][]string {
+		res, err := app.deliverTx(tx, sender)
+		require.NoError(err)
+		found := make(map[string][]string)
+		for _, tag := range res.Tags {
+			value := tag.ValueString
+			if tag.ValueType == abci.KVPair_INT {
+				value = strconv.FormatInt(tag.ValueInt, 10)
+			}
+			found[tag.Key] = append(found[tag.Key], value)
+		}
+		return found
+	}
+	delegator, candidate := sender.String(), pk1.KeyString()
+
+	got := tags(signCandidacy(newTxDeclareCandidacy(100, pk1), "testChain", sender).Wrap())
+	assert.Equal([]string{ActionDeclareCandidacy, ActionDelegate}, got[TagAction])
+	assert.Equal([]string{delegator, delegator}, got[TagDelegator])
+	assert.Equal([]string{candidate, candidate}, got[TagCandidate])
+	assert.Equal([]string{"100fermion"}, got[TagAmount])
+	assert.Equal([]string{"100"}, got[TagShares])
+
+	got = tags(newTxUnbond(40, pk1).Wrap())
+	assert.Equal([]string{ActionUnbond}, got[TagAction])
+	assert.Equal([]string{candidate}, got[TagCandidate])
+	assert.Equal([]string{"40fermion"}, got[TagAmount])
+	assert.Equal([]string{"40"}, got[TagShares])
+
+	// a batch is tagged with each of its actions
+	got = tags(NewTxStakeBatch([]sdk.Tx{
+		newTxDelegate(10, pk1).Wrap(),
+		NewTxEditCandidacy(pk1, Description{Moniker: "foo"}),
+	}))
+	assert.Equal([]string{ActionDelegate, ActionEditCandidacy}, got[TagAction])
+	assert.Equal([]string{"10fermion"}, got[TagAmount])
+}
+
+func TestTxEvents(t *testing.T) {
+	assert := assert.New(t)
+	delegator := sdk.Actor{"", "sigs", []byte("delegator")}
+	tags := new(txTags)
+	tags.add(ActionDeclareCandidacy, delegator, pk1, coin.Coin{}, 0)
+	tags.add(ActionDelegate, delegator, pk1, coin.Coin{"fermion", 10}, 10)
+	tags.add(ActionUnbond, delegator, pk2, coin.Coin{"fermion", 5}, 5)
+
+	// tags of other modules are skipped
+	pairs := append([]*abci.KVPair{abci.KVPairString("coin.sender", "foo")}, tags.pairs...)
+
+	events := TxEvents(pairs)
+	assert.Equal([]TxEvent{
+		{ActionDeclareCandidacy, delegator.String(), pk1.KeyString(), "", 0, "", ""},
+		{ActionDelegate, delegator.String(), pk1.KeyString(), "10fermion", 10, "", ""},
+		{ActionUnbond, delegator.String(), pk2.KeyString(), "5fermion", 5, "", ""},
+	}, events)
+}
+
+func TestMinBonds(t *testing.T) {
+	assert := assert.New(t)
+	senders, accStore := initAccounts(2, 1000)
+	owner, delegator := senders[0], senders[1]
+
+	deliverer := newDeliver(owner, accStore)
+	params := loadParams(deliverer.store)
+	params.MinSelfBond = 100
+	params.MinDelegation = 10
+	saveParams(deliverer.store, params)
+	checker := check{store: deliverer.store, sender: owner}
+
+	// declaring takes the min self-bond
+	assert.Error(checker.declareCandidacy(signCandidacy(newTxDeclareCandidacy(99, pk1), "", owner)))
+	assert.NoError(checker.declareCandidacy(signCandidacy(newTxDeclareCandidacy(100, pk1), "", owner)))
+	assert.NoError(deliverer.declareCandidacy(newTxDeclareCandidacy(150, pk1)))
+
+	// the owner can't unbond below the min self-bond, only everything
+	assert.Error(checker.unbond(newTxUnbond(51, pk1)))
+	assert.NoError(checker.unbond(newTxUnbond(50, pk1)))
+	assert.NoError(checker.unbond(newTxUnbond(150, pk1)))
+
+	// delegations can't be dust, but can top up a bond
+	checker.sender, deliverer.sender = delegator, delegator
+	assert.Error(checker.delegate(newTxDelegate(9, pk1)))
+	assert.NoError(checker.delegate(newTxDelegate(10, pk1)))
+	assert.NoError(deliverer.delegate(newTxDelegate(10, pk1)))
+	assert.NoError(checker.delegate(newTxDelegate(1, pk1)))
+
+	// and partial unbonds can't leave dust behind
+	assert.NoError(deliverer.delegate(newTxDelegate(5, pk1)))
+	assert.Error(checker.unbond(newTxUnbond(6, pk1)))
+	assert.NoError(checker.unbond(newTxUnbond(5, pk1)))
+	assert.NoError(checker.unbond(newTxUnbond(15, pk1)))
+}
+
+func TestRotateConsensusKey(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	senders, accStore := initAccounts(3, 1000)
+	owner, delegator := senders[0], senders[1]
+
+	deliverer := newDeliver(owner, accStore)
+	store := deliverer.store
+	require.NoError(deliverer.declareCandidacy(newTxDeclareCandidacy(100, pk1)))
+	require.NoError(deliverer.declareCandidacy(newTxDeclareCandidacy(10, pk3)))
+	deliverer.sender = delegator
+	require.NoError(deliverer.delegate(newTxDelegate(50, pk1)))
+	_, err := UpdateValidatorSet(store, 1)
+	require.NoError(err)
+
+	// only the owner can rotate, and not onto another candidate
+	rotate := func(pk, newPk crypto.PubKey, signer sdk.Actor) TxRotateConsensusKey {
+		return signRotation(TxRotateConsensusKey{PubKey: pk, NewPubKey: newPk}, "", signer)
+	}
+	checker := check{store: store, sender: delegator}
+	assert.Error(checker.rotateConsensusKey(rotate(pk1, pk2, delegator)))
+	checker.sender = owner
+	assert.Error(checker.rotateConsensusKey(rotate(pk2, pk1, owner)))
+	assert.Error(checker.rotateConsensusKey(rotate(pk1, pk3, owner)))
+
+	// nor onto a key the owner doesn't hold
+	tx := rotate(pk1, pk2, owner)
+	assert.Error(checker.rotateConsensusKey(rotate(pk1, pk2, delegator)))
+	squat := tx
+	squat.NewPubKeySig = rotate(pk2, pk3, owner).NewPubKeySig
+	assert.Error(checker.rotateConsensusKey(squat))
+	squat.NewPubKeySig = crypto.Signature{}
+	assert.Error(squat.ValidateBasic())
+	assert.NoError(tx.ValidateBasic())
+	assert.NoError(checker.rotateConsensusKey(tx))
+
+	deliverer.sender = owner
+	require.NoError(deliverer.rotateConsensusKey(tx))
+
+	// the candidate and the bonds have moved
+	assert.Nil(loadCandidate(store, pk1))
+	candidate := loadCandidate(store, pk2)
+	require.NotNil(candidate)
+	assert.Equal(owner, candidate.Owner)
+	assert.Equal(uint64(150), candidate.Shares)
+	assert.Nil(loadCandidateDelegators(store, pk1))
+	assert.Equal([]sdk.Actor{owner, delegator}, loadCandidateDelegators(store, pk2))
+	for _, actor := range []sdk.Actor{owner, delegator} {
+		assert.Nil(loadDelegatorBond(store, actor, pk1))
+		assert.NotNil(loadDelegatorBond(store, actor, pk2))
+	}
+	assert.Equal([]crypto.PubKey{pk3, pk2}, loadDelegatorCandidates(store, owner))
+
+	assert.Equal([]keyRotation{{pk1, pk2}}, loadKeyRotations(store))
+
+	// the old key is removed and the new key added with the full power, at
+	// once whatever the churn limit
+	change, err := UpdateValidatorSet(store, 2)
+	require.NoError(err)
+	require.Equal(2, len(change), "%v", change)
+	changed := map[string]int64{}
+	for _, c := range change {
+		changed[string(c.PubKey)] = c.Power
+	}
+	assert.Equal(int64(0), changed[string(pubKeyBytes(pk1))])
+	assert.Equal(int64(150), changed[string(pubKeyBytes(pk2))])
+	assert.Nil(loadKeyRotations(store))
+	assert.Len(loadValidatorSet(store, 3), 2)
+}
+
+func TestTransferOwnership(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	senders, accStore := initAccounts(3, 1000)
+	owner, newOwner, other := senders[0], senders[1], senders[2]
+
+	deliverer := newDeliver(owner, accStore)
+	store := deliverer.store
+	require.NoError(deliverer.declareCandidacy(newTxDeclareCandidacy(100, pk1)))
+	deliverer.sender = newOwner
+	require.NoError(deliverer.delegate(newTxDelegate(20, pk1)))
+
+	// only the owner can transfer, and not to themselves
+	checker := check{store: store, sender: other}
+	assert.Error(checker.transferOwnership(TxTransferOwnership{pk1, newOwner}))
+	checker.sender = owner
+	assert.Error(checker.transferOwnership(TxTransferOwnership{pk1, owner}))
+	assert.Error(checker.transferOwnership(TxTransferOwnership{pk2, newOwner}))
+	assert.NoError(checker.transferOwnership(TxTransferOwnership{pk1, newOwner}))
+
+	deliverer.sender = owner
+	require.NoError(deliverer.transferOwnership(TxTransferOwnership{pk1, newOwner}))
+
+	// the self-bond is merged into the new owner's bond
+	candidate := loadCandidate(store, pk1)
+	assert.Equal(newOwner, candidate.Owner)
+	assert.Equal(uint64(120), candidate.Shares)
+	assert.Nil(loadDelegatorBond(store, owner, pk1))
+	assert.Empty(loadDelegatorCandidates(store, owner))
+	assert.Equal(uint64(120), loadDelegatorBond(store, newOwner, pk1).Shares)
+	assert.Equal([]sdk.Actor{newOwner}, loadCandidateDelegators(store, pk1))
+
+	// and only the new owner can transfer again
+	assert.Error(checker.transferOwnership(TxTransferOwnership{pk1, other}))
+	checker.sender = newOwner
+	assert.NoError(checker.transferOwnership(TxTransferOwnership{pk1, other}))
+}
+
+func TestTxActAs(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	signer, cosigner := auth.SigPerm([]byte("signer")), auth.SigPerm([]byte("cosigner"))
+	role := sdk.NewActor("role", []byte("treasury"))
+	app := newTestApp(t, signer, role)
+	store := app.store
+
+	declare := signCandidacy(newTxDeclareCandidacy(100, pk1), "testChain", signer)
+	_, err := app.deliverTx(declare.Wrap(), signer)
+	require.NoError(err)
+
+	// the role must be among the permissions to act for it
+	delegate := NewTxActAs(role, newTxDelegate(300, pk1).Wrap())
+	_, err = app.deliverTx(delegate, signer)
+	assert.Error(err)
+
+	// a multisig role has several signers, each one alone can't act
+	_, err = app.deliverTx(newTxDelegate(300, pk1).Wrap(), signer, cosigner, role)
+	assert.Error(err)
+
+	_, err = app.deliverTx(delegate, signer, cosigner, role)
+	require.NoError(err)
+	assert.Equal(int64(700), app.balance(role))
+	assert.Equal(uint64(300), loadDelegatorBond(store, role, pk1).Shares)
+	assert.Equal(uint64(100), loadDelegatorBond(store, signer, pk1).Shares)
+
+	unbond := NewTxActAs(role, newTxUnbond(100, pk1).Wrap())
+	_, err = app.deliverTx(unbond, signer, cosigner, role)
+	require.NoError(err)
+	assert.Equal(int64(800), app.balance(role))
+	assert.Equal(uint64(200), loadDelegatorBond(store, role, pk1).Shares)
+
+	// only stake txs can be run for an actor, and not nested
+	assert.Error(NewTxActAs(role, coin.NewSendOneTx(role, signer, coin.Coins{{"fermion", 1}})).ValidateBasic())
+	assert.Error(NewTxActAs(role, unbond).ValidateBasic())
+	assert.Error(NewTxActAs(sdk.Actor{}, newTxUnbond(100, pk1).Wrap()).ValidateBasic())
+}
+
+func TestDeliverTxRevokeCandidacy(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	owner, delegator := auth.SigPerm([]byte("owner")), auth.SigPerm([]byte("delegator"))
+	app := newTestApp(t, owner, delegator)
+	store, balance := app.store, app.balance
+	params := loadParams(store)
+	params.MaxPowerChurn = 0 // the validator set may change at once
+	params.MinValidators = 0 // and be left empty
+	saveParams(store, params)
+
+	declare := signCandidacy(newTxDeclareCandidacy(100, pk1), "testChain", owner)
+	_, err := app.deliverTx(declare.Wrap(), owner)
+	require.NoError(err)
+	_, err = app.deliverTx(newTxDelegate(300, pk1).Wrap(), delegator)
+	require.NoError(err)
+	_, err = UpdateValidatorSet(store, 1)
+	require.NoError(err)
+
+	// only the owner can revoke
+	_, err = app.deliverTx(NewTxRevokeCandidacy(pk1), delegator)
+	assert.Error(err)
+
+	// nor while some shares have no bond, which leaves everything in place
+	candidate := loadCandidate(store, pk1)
+	candidate.Shares += 50
+	saveCandidate(store, candidate)
+	_, err = app.deliverTx(NewTxRevokeCandidacy(pk1), owner)
+	assert.Error(err)
+	assert.Equal(int64(900), balance(owner))
+	assert.Equal(int64(700), balance(delegator))
+	assert.NotNil(loadDelegatorBond(store, owner, pk1))
+	assert.NotNil(loadDelegatorBond(store, delegator, pk1))
+	candidate.Shares -= 50
+	saveCandidate(store, candidate)
+
+	// which is charged for each delegator unbonded
+	res, err := app.deliverTx(NewTxRevokeCandidacy(pk1), owner)
+	require.NoError(err)
+	assert.Equal(params.GasRevokeCandidacy+2*params.GasUnbond, res.GasUsed)
+	events := TxEvents(res.Tags)
+	require.Len(events, 3)
+	assert.Equal(ActionRevokeCandidacy, events[0].Action)
+	assert.Equal(ActionUnbond, events[1].Action)
+	assert.Equal(ActionUnbond, events[2].Action)
+
+	// everybody has their coins back and nothing is left in the store
+	assert.Equal(int64(1000), balance(owner))
+	assert.Equal(int64(1000), balance(delegator))
+	assert.Nil(loadCandidate(store, pk1))
+	assert.Empty(loadCandidatesPubKeys(store))
+	assert.Nil(loadCandidateDelegators(store, pk1))
+	for _, actor := range []sdk.Actor{owner, delegator} {
+		assert.Nil(loadDelegatorBond(store, actor, pk1))
+		assert.Nil(loadDelegatorCandidates(store, actor))
+	}
+
+	// and the validator is removed at the next update
+	change, err := UpdateValidatorSet(store, 2)
+	require.NoError(err)
+	require.Len(change, 1)
+	assert.Equal(int64(0), change[0].Power)
+}
+
+func TestSafetyThreshold(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	senders, accStore := initAccounts(2, 1000)
+	owner, delegator := senders[0], senders[1]
+
+	deliverer := newDeliver(owner, accStore)
+	store := deliverer.store
+	params := loadParams(store)
+	params.MaxPowerChurn = 0 // the validator set may change at once
+	params.MinValidators = 0 // and be left empty
+	saveParams(store, params)
+	checker := check{store: store, sender: owner}
+	threshold := SafetyThreshold{MinSelfBondRatio: 5000, MaxTotalDelegation: 300}
+
+	// the self-bond can't start beyond the threshold
+	declare := newTxDeclareCandidacy(400, pk1)
+	declare.Threshold = threshold
+	assert.Error(checker.declareCandidacy(signCandidacy(declare, "", owner)))
+	declare.Bond.Amount = 100
+	assert.NoError(checker.declareCandidacy(signCandidacy(declare, "", owner)))
+	require.NoError(deliverer.declareCandidacy(declare))
+
+	// delegators can't bring the self-bond below half of all shares
+	checker.sender, deliverer.sender = delegator, delegator
+	assert.Error(checker.delegate(newTxDelegate(101, pk1)))
+	assert.NoError(checker.delegate(newTxDelegate(100, pk1)))
+	require.NoError(deliverer.delegate(newTxDelegate(100, pk1)))
+
+	// and the owner can't bond beyond the max total
+	checker.sender, deliverer.sender = owner, owner
+	assert.Error(checker.delegate(newTxDelegate(101, pk1)))
+	assert.NoError(checker.delegate(newTxDelegate(100, pk1)))
+	require.NoError(deliverer.delegate(newTxDelegate(100, pk1)))
+
+	_, err := UpdateValidatorSet(store, 1)
+	require.NoError(err)
+	assert.Equal(uint64(300), loadCandidate(store, pk1).VotingPower)
+
+	// raising the ratio past the self-bond takes the candidate out of the set
+	edit := TxEditCandidacy{PubKey: pk1, Threshold: &SafetyThreshold{MinSelfBondRatio: 8000}}
+	require.NoError(edit.ValidateBasic())
+	require.NoError(deliverer.editCandidacy(edit))
+	change, err := UpdateValidatorSet(store, 2)
+	require.NoError(err)
+	require.Len(change, 1)
+	assert.Equal(int64(0), change[0].Power)
+	assert.Equal(uint64(0), loadCandidate(store, pk1).VotingPower)
+
+	// a ratio can't be more than all the shares
+	edit.Threshold.MinSelfBondRatio = maxRatio + 1
+	assert.Error(edit.ValidateBasic())
+}
+
+func TestLiquidPool(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	owner1, owner2 := auth.SigPerm([]byte("owner1")), auth.SigPerm([]byte("owner2"))
+	stayer, leaver := auth.SigPerm([]byte("stayer")), auth.SigPerm([]byte("leaver"))
+	app := newTestApp(t, owner1, owner2, stayer, leaver)
+	store, balance := app.store, app.balance
+	deliverTx := func(actor sdk.Actor, tx sdk.Tx) error {
+		_, err := app.deliverTx(tx, actor)
+		return err
+	}
+	params := loadParams(store)
+	params.MaxVals = 1
+	params.MaxPowerChurn = 0
+	saveParams(store, params)
+
+	// pk1 validates with the coins of two delegators
+	declare := signCandidacy(newTxDeclareCandidacy(200, pk1), "testChain", owner1)
+	require.NoError(deliverTx(owner1, declare.Wrap()))
+	require.NoError(deliverTx(stayer, newTxDelegate(100, pk1).Wrap()))
+	require.NoError(deliverTx(leaver, newTxDelegate(50, pk1).Wrap()))
+	declare = signCandidacy(newTxDeclareCandidacy(300, pk2), "testChain", owner2)
+	require.NoError(deliverTx(owner2, declare.Wrap()))
+	_, err := UpdateValidatorSet(store, 1)
+	require.NoError(err)
+	assert.Equal(uint64(350), loadCandidate(store, pk1).VotingPower)
+
+	// pk2 taking its place only leaves the delegators of pk1 bonded to it
+	require.NoError(deliverTx(owner2, newTxDelegate(100, pk2).Wrap()))
+	_, err = UpdateValidatorSet(store, 2)
+	require.NoError(err)
+	candidate := loadCandidate(store, pk1)
+	assert.Equal(uint64(0), candidate.VotingPower)
+	assert.Equal(uint64(350), candidate.Shares)
+	assert.Nil(loadLiquidPool(store, pk1))
+	assert.Empty(loadPoolChanges(store, 2))
+
+	// so pk1 can climb back into the set
+	require.NoError(deliverTx(owner1, newTxDelegate(100, pk1).Wrap()))
+	_, err = UpdateValidatorSet(store, 3)
+	require.NoError(err)
+	assert.Equal(uint64(450), loadCandidate(store, pk1).VotingPower)
+
+	// once pk1 is kicked out without the min self-bond, the delegators of pk1
+	// are moved to the pool
+	params.MinSelfBond = 400
+	saveParams(store, params)
+	_, err = UpdateValidatorSet(store, 4)
+	require.NoError(err)
+	candidate = loadCandidate(store, pk1)
+	assert.Equal(uint64(0), candidate.VotingPower)
+	assert.Equal(uint64(300), candidate.Shares)
+	assert.Nil(loadDelegatorBond(store, stayer, pk1))
+	assert.Nil(loadDelegatorBond(store, leaver, pk1))
+	pool := loadLiquidPool(store, pk1)
+	require.NotNil(pool)
+	assert.Equal(int64(150), pool.Total())
+	assert.Equal([]PoolChange{
+		{pk1, stayer, ActionPool, 100},
+		{pk1, leaver, ActionPool, 50},
+	}, loadPoolChanges(store, 4))
+
+	// the pooled coins can be withdrawn once
+	assert.Error(deliverTx(owner1, NewTxWithdrawPool(pk1)))
+	require.NoError(deliverTx(leaver, NewTxWithdrawPool(pk1)))
+	assert.Equal(int64(1000), balance(leaver))
+	assert.Error(deliverTx(leaver, NewTxWithdrawPool(pk1)))
+
+	// and the rest is bonded back when pk1 validates again
+	require.NoError(deliverTx(owner1, newTxDelegate(200, pk1).Wrap()))
+	change, err := UpdateValidatorSet(store, 5)
+	require.NoError(err)
+	require.Len(change, 2)
+	assert.Equal(uint64(600), loadCandidate(store, pk1).Shares)
+	assert.Equal(uint64(100), loadDelegatorBond(store, stayer, pk1).Shares)
+	assert.Nil(loadLiquidPool(store, pk1))
+	assert.Equal(int64(900), balance(stayer))
+	assert.Equal([]PoolChange{{pk1, stayer, ActionRebond, 100}}, loadPoolChanges(store, 5))
+}
+
+func TestMinValidators(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	owner1, owner2 := auth.SigPerm([]byte("owner1")), auth.SigPerm([]byte("owner2"))
+	app := newTestApp(t, owner1, owner2)
+	store := app.store
+	deliverTx := func(actor sdk.Actor, tx sdk.Tx) error {
+		_, err := app.deliverTx(tx, actor)
+		return err
+	}
+	params := loadParams(store)
+	params.MaxPowerChurn = 0
+	saveParams(store, params)
+
+	// the minimum can't be more than the max_vals
+	assert.Error(app.handler.initState(stakingModuleName, "min_validators", "-1", store))
+	assert.Error(app.handler.initState(stakingModuleName, "min_validators", "101", store))
+	require.NoError(app.handler.initState(stakingModuleName, "min_validators", "1", store))
+
+	declare := signCandidacy(newTxDeclareCandidacy(100, pk1), "testChain", owner1)
+	require.NoError(deliverTx(owner1, declare.Wrap()))
+	declare = signCandidacy(newTxDeclareCandidacy(50, pk2), "testChain", owner2)
+	require.NoError(deliverTx(owner2, declare.Wrap()))
+	_, err := UpdateValidatorSet(store, 1)
+	require.NoError(err)
+
+	// one of the two validators can leave
+	require.NoError(deliverTx(owner2, NewTxUnbond(50, pk2)))
+	_, err = UpdateValidatorSet(store, 2)
+	require.NoError(err)
+
+	// but not the last one
+	assert.Error(deliverTx(owner1, NewTxUnbond(100, pk1)))
+	assert.Error(deliverTx(owner1, NewTxRevokeCandidacy(pk1)))
+	assert.NoError(deliverTx(owner1, NewTxUnbond(10, pk1)))
+
+	// which keeps validating when it crosses its safety threshold
+	edit := TxEditCandidacy{PubKey: pk1, Threshold: &SafetyThreshold{MaxTotalDelegation: 50}}
+	require.NoError(deliverTx(owner1, edit.Wrap()))
+	change, err := UpdateValidatorSet(store, 3)
+	require.NoError(err)
+	assert.Len(change, 1)
+	assert.Equal(uint64(90), loadCandidate(store, pk1).VotingPower)
+
+	// until a replacement joins
+	declare = signCandidacy(newTxDeclareCandidacy(50, pk3), "testChain", owner2)
+	require.NoError(deliverTx(owner2, declare.Wrap()))
+	change, err = UpdateValidatorSet(store, 4)
+	require.NoError(err)
+	assert.Len(change, 2)
+	assert.Equal(uint64(0), loadCandidate(store, pk1).VotingPower)
+}
@@ -0,0 +1,124 @@
+package stake
+
+import (
+	"fmt"
+
+	"github.com/tendermint/go-wire"
+
+	"github.com/cosmos/cosmos-sdk/modules/coin"
+	"github.com/cosmos/cosmos-sdk/stack"
+	"github.com/cosmos/cosmos-sdk/state"
+)
+
+// Invariants - check the stake state for inconsistencies and report each
+// violation found, nil if there are none. The store is the global store of
+// the app, as the bonded coins are read from the coin module's accounts.
+//
+// The invariants are:
+//   - the candidate pubkeys list holds each stored candidate exactly once
+//   - the shares of all the bonds to a candidate sum to the candidate's shares
+//   - the hold account holds the coins worth all the candidates' shares,
+//     along with the coins in the liquid pools
+func Invariants(store state.SimpleDB) (violations []string) {
+	stakeStore := stack.PrefixedStore(Name(), store)
+	coinStore := stack.PrefixedStore(coin.NameCoin, store)
+	params := loadParams(stakeStore)
+
+	report := func(format string, args ...interface{}) {
+		violations = append(violations, fmt.Sprintf(format, args...))
+	}
+
+	// the stored candidates, in store order, and by pubkey
+	var stored Candidates
+	candidates := make(map[string]*Candidate)
+	for _, m := range listPrefixed(store, CandidateKeyPrefix) {
+		candidate := new(Candidate)
+		if err := wire.ReadBinaryBytes(m.Value, candidate); err != nil {
+			report("cannot read candidate at key %X: %v", m.Key, err)
+			continue
+		}
+		stored = append(stored, candidate)
+		candidates[candidate.PubKey.KeyString()] = candidate
+	}
+
+	// which must match the list of pubkeys
+	listed := make(map[string]bool)
+	for _, pk := range loadCandidatesPubKeys(stakeStore) {
+		ks := pk.KeyString()
+		if listed[ks] {
+			report("candidate %s is listed twice", ks)
+		}
+		listed[ks] = true
+		if candidates[ks] == nil {
+			report("candidate %s is listed but not stored", ks)
+		}
+	}
+	for _, candidate := range stored {
+		if ks := candidate.PubKey.KeyString(); !listed[ks] {
+			report("candidate %s is stored but not listed", ks)
+		}
+	}
+
+	// the bonds must add up to each candidate's shares
+	bondShares := make(map[string]uint64)
+	for _, m := range listPrefixed(store, DelegatorBondKeyPrefix) {
+		bond := new(DelegatorBond)
+		if err := wire.ReadBinaryBytes(m.Value, bond); err != nil {
+			report("cannot read bond at key %X: %v", m.Key, err)
+			continue
+		}
+		ks := bond.PubKey.KeyString()
+		if candidates[ks] == nil {
+			report("bond at key %X is to candidate %s which is not stored", m.Key, ks)
+		}
+		bondShares[ks] += bond.Shares
+	}
+
+	var bonded int64
+	for _, candidate := range stored {
+		ks := candidate.PubKey.KeyString()
+		if candidate.Shares != bondShares[ks] {
+			report("candidate %s has %d shares but its bonds sum to %d",
+				ks, candidate.Shares, bondShares[ks])
+		}
+		bonded += candidate.CoinsFromShares(candidate.Shares)
+	}
+
+	// the pools hold unbonded coins, which are still in the hold account
+	var pooled int64
+	for _, m := range listPrefixed(store, LiquidPoolKeyPrefix) {
+		pool := new(LiquidPool)
+		if err := wire.ReadBinaryBytes(m.Value, pool); err != nil {
+			report("cannot read liquid pool at key %X: %v", m.Key, err)
+			continue
+		}
+		pooled += pool.Total()
+	}
+
+	// and the hold account must hold the bonded and pooled coins
+	acc, err := coin.GetAccount(coinStore, params.HoldAccount)
+	if err != nil {
+		report("cannot read the hold account: %v", err)
+		return
+	}
+	var held int64
+	for _, c := range acc.Coins {
+		if c.Denom == params.AllowedBondDenom {
+			held = c.Amount
+		}
+	}
+	if held != bonded+pooled {
+		report("hold account holds %d%s but the candidates' shares are worth %d%s"+
+			" and the liquid pools hold %d%s", held, params.AllowedBondDenom,
+			bonded, params.AllowedBondDenom, pooled, params.AllowedBondDenom)
+	}
+	return
+}
+
+// listPrefixed - list all the stake keys with the prefix from the global
+// store. The List of a prefixed store can't be used with short keys, as it
+// appends both start and end to the same prefix slice.
+func listPrefixed(store state.SimpleDB, prefix []byte) []state.Model {
+	return store.List(stack.PrefixedKey(Name(), prefix),
+		stack.PrefixedKey(Name(), prefixEnd(prefix)), 0)
+}
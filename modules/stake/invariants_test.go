@@ -0,0 +1,71 @@
+package stake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	crypto "github.com/tendermint/go-crypto"
+
+	"github.com/cosmos/cosmos-sdk/modules/coin"
+	"github.com/cosmos/cosmos-sdk/stack"
+	"github.com/cosmos/cosmos-sdk/state"
+)
+
+func TestInvariants(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+
+	store := state.NewMemKVStore()
+	stakeStore := stack.PrefixedStore(Name(), store)
+	coinStore := stack.PrefixedStore(coin.NameCoin, store)
+	params := loadParams(stakeStore)
+	delegators := newActors(2)
+
+	// two candidates with bonds worth the held coins
+	for i, pk := range pks[:2] {
+		candidate := NewCandidate(pk, delegators[i])
+		candidate.Shares = 30
+		saveCandidate(stakeStore, candidate)
+		saveDelegatorBond(stakeStore, delegators[0], &DelegatorBond{pk, 10})
+		saveDelegatorBond(stakeStore, delegators[1], &DelegatorBond{pk, 20})
+	}
+	_, err := coin.ChangeCoins(coinStore, params.HoldAccount,
+		coin.Coins{{params.AllowedBondDenom, 60}})
+	require.NoError(err)
+	assert.Empty(Invariants(store))
+
+	// bonds which don't add up to the candidate's shares
+	candidate := loadCandidate(stakeStore, pks[0])
+	candidate.Shares = 31
+	saveCandidate(stakeStore, candidate)
+	violations := Invariants(store)
+	require.Len(violations, 2, "%v", violations)
+	assert.Contains(violations[0], "its bonds sum to 30")
+	assert.Contains(violations[1], "hold account holds 60")
+	candidate.Shares = 30
+	saveCandidate(stakeStore, candidate)
+
+	// a candidate which isn't listed
+	saveCandidatesPubKeys(stakeStore, pks[:1])
+	violations = Invariants(store)
+	require.Len(violations, 1, "%v", violations)
+	assert.Contains(violations[0], "stored but not listed")
+
+	// and one listed twice which isn't stored
+	saveCandidatesPubKeys(stakeStore, []crypto.PubKey{pks[0], pks[1], pks[2], pks[2]})
+	violations = Invariants(store)
+	require.Len(violations, 3, "%v", violations)
+	assert.Contains(violations[0], "listed but not stored")
+	assert.Contains(violations[1], "listed twice")
+	saveCandidatesPubKeys(stakeStore, pks[:2])
+	assert.Empty(Invariants(store))
+
+	// coins taken from the hold account
+	_, err = coin.ChangeCoins(coinStore, params.HoldAccount,
+		coin.Coins{{params.AllowedBondDenom, -1}})
+	require.NoError(err)
+	violations = Invariants(store)
+	require.Len(violations, 1, "%v", violations)
+	assert.Contains(violations[0], "hold account holds 59")
+}
@@ -0,0 +1,164 @@
+package stake
+
+import (
+	"github.com/cosmos/cosmos-sdk"
+	"github.com/cosmos/cosmos-sdk/state"
+
+	crypto "github.com/tendermint/go-crypto"
+)
+
+// LiquidPool - the coins of the delegators of a candidate which was kicked
+// out of the validator set. The coins stay in the hold account, unbonded,
+// until the delegator withdraws them or the candidate validates again and
+// they are bonded back to it.
+type LiquidPool struct {
+	PubKey  crypto.PubKey `json:"pub_key"` // candidate the coins were bonded to
+	Entries []PoolEntry   `json:"entries"`
+}
+
+// PoolEntry - the coins of one delegator in a liquid pool
+type PoolEntry struct {
+	Delegator sdk.Actor `json:"delegator"`
+	Amount    int64     `json:"amount"` // in the allowed bond denomination
+}
+
+// Total - the coins held in the pool for all the delegators
+func (p *LiquidPool) Total() (total int64) {
+	for _, e := range p.Entries {
+		total += e.Amount
+	}
+	return
+}
+
+// add the coins to the delegator's entry
+func (p *LiquidPool) add(delegator sdk.Actor, amount int64) {
+	for i, e := range p.Entries {
+		if e.Delegator.Equals(delegator) {
+			p.Entries[i].Amount += amount
+			return
+		}
+	}
+	p.Entries = append(p.Entries, PoolEntry{delegator, amount})
+}
+
+// remove the delegator's entry, returning the coins it held
+func (p *LiquidPool) remove(delegator sdk.Actor) int64 {
+	for i, e := range p.Entries {
+		if e.Delegator.Equals(delegator) {
+			p.Entries = append(p.Entries[:i], p.Entries[i+1:]...)
+			return e.Amount
+		}
+	}
+	return 0
+}
+
+// PoolChange - a delegator's coins moved into or out of the liquid pool of a
+// candidate by a validator set update, recorded as an event for the height
+// the update is made at
+type PoolChange struct {
+	PubKey    crypto.PubKey `json:"pub_key"`
+	Delegator sdk.Actor     `json:"delegator"`
+	Action    string        `json:"action"` // ActionPool or ActionRebond
+	Amount    int64         `json:"amount"` // in the allowed bond denomination
+}
+
+// updateLiquidPools - move the bonds of every delegator but the owner of a
+// kicked candidate leaving the validator set into its pool, and bond the pool
+// of a candidate joining the validator set back to it. The validators before
+// the update are v1 and after it v2, as sent to Tendermint. The bonds moved
+// are returned as events.
+func updateLiquidPools(store state.SimpleDB, v1, v2 Validators, candidates Candidates) (changes []PoolChange) {
+	validated := make(map[string]bool)
+	for _, v := range v1 {
+		validated[v.PubKey.KeyString()] = true
+	}
+	validates := make(map[string]bool)
+	for _, v := range v2 {
+		validates[v.PubKey.KeyString()] = true
+	}
+
+	params := loadParams(store)
+	for _, c := range candidates {
+		was, is := validated[c.PubKey.KeyString()], validates[c.PubKey.KeyString()]
+		switch {
+		case was && !is && c.kicked(store, params):
+			changes = append(changes, poolBonds(store, c)...)
+		case !was && is:
+			changes = append(changes, rebondPool(store, c)...)
+		}
+	}
+	return
+}
+
+// kicked - whether the candidate can't validate whatever its rank, as its
+// owner holds no shares, or it's beyond its safety threshold or without the
+// min self-bond. A candidate only ranked below Params.MaxVals keeps its
+// delegators, so it may climb back into the validator set.
+func (c *Candidate) kicked(store state.SimpleDB, params Params) bool {
+	selfShares := c.selfShares(store)
+	return selfShares == 0 || c.crossesThreshold(c.Shares, selfShares) ||
+		!hasMinSelfBond(store, params, c)
+}
+
+// poolBonds - unbond all the delegators but the owner into the candidate's
+// pool. A candidate left without shares is removed.
+func poolBonds(store state.SimpleDB, c *Candidate) (changes []PoolChange) {
+	pool := loadLiquidPool(store, c.PubKey)
+	if pool == nil {
+		pool = &LiquidPool{PubKey: c.PubKey}
+	}
+
+	for _, delegator := range loadCandidateDelegators(store, c.PubKey) {
+		if delegator.Equals(c.Owner) {
+			continue
+		}
+		bond := loadDelegatorBond(store, delegator, c.PubKey)
+		amount := c.CoinsFromShares(bond.Shares)
+		pool.add(delegator, amount)
+		c.Shares -= bond.Shares
+		removeDelegatorBond(store, delegator, c.PubKey)
+		changes = append(changes, PoolChange{c.PubKey, delegator, ActionPool, amount})
+	}
+	saveLiquidPool(store, pool)
+
+	if c.Shares == 0 {
+		removeCandidate(store, c.PubKey)
+		return
+	}
+	saveCandidate(store, c)
+	return
+}
+
+// rebondPool - bond the coins of every delegator still in the candidate's
+// pool back to it, the candidate's voting power grows with its shares from
+// the next update. The pool is left alone if bonding it would cross the
+// candidate's safety threshold, which would only kick the candidate out
+// again.
+func rebondPool(store state.SimpleDB, c *Candidate) (changes []PoolChange) {
+	pool := loadLiquidPool(store, c.PubKey)
+	if pool == nil {
+		return
+	}
+	if c.crossesThreshold(c.Shares+c.SharesFromCoins(pool.Total()), c.selfShares(store)) {
+		return
+	}
+
+	for _, e := range pool.Entries {
+		bond := loadDelegatorBond(store, e.Delegator, c.PubKey)
+		if bond == nil {
+			bond = &DelegatorBond{
+				PubKey: c.PubKey,
+				Shares: 0,
+			}
+		}
+		shares := c.SharesFromCoins(e.Amount)
+		bond.Shares += shares
+		c.Shares += shares
+		saveDelegatorBond(store, e.Delegator, bond)
+		changes = append(changes, PoolChange{c.PubKey, e.Delegator, ActionRebond, e.Amount})
+	}
+	pool.Entries = nil
+	saveLiquidPool(store, pool)
+	saveCandidate(store, c)
+	return
+}
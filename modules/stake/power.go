@@ -0,0 +1,218 @@
+package stake
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"github.com/cosmos/cosmos-sdk/state"
+)
+
+// Names of the built-in voting power functions
+const (
+	// PowerLinear - the voting power is the shares
+	PowerLinear = "linear"
+	// PowerSqrt - the voting power is the integer square root of the shares
+	PowerSqrt = "sqrt"
+	// PowerCappedLog - the voting power is the shares up to the
+	// Params.PowerLogKnee, beyond which each doubling of the shares only adds
+	// another PowerLogKnee of power
+	PowerCappedLog = "capped-log"
+)
+
+// PowerFunction - gives the voting power of a validator's shares. It must be
+// deterministic, increasing, and give some power for any shares. The
+// function in use is named by Params.PowerFunction.
+type PowerFunction func(params Params, shares uint64) uint64
+
+var powerFunctions = map[string]PowerFunction{
+	PowerLinear:    linearPower,
+	PowerSqrt:      sqrtPower,
+	PowerCappedLog: cappedLogPower,
+}
+
+// RegisterPowerFunction - make a function available to Params.PowerFunction,
+// to be called from an init function
+func RegisterPowerFunction(name string, power PowerFunction) {
+	if _, ok := powerFunctions[name]; ok {
+		panic(fmt.Sprintf("power function %q is already registered", name))
+	}
+	powerFunctions[name] = power
+}
+
+// GetPowerFunction - get the power function registered with the name
+func GetPowerFunction(name string) (PowerFunction, error) {
+	power, ok := powerFunctions[name]
+	if !ok {
+		return nil, ErrUnknownPowerFunction(name)
+	}
+	return power, nil
+}
+
+func linearPower(_ Params, shares uint64) uint64 {
+	return shares
+}
+
+func sqrtPower(_ Params, shares uint64) uint64 {
+	return isqrt(shares)
+}
+
+// the shares from the knee k<<j to k<<(j+1) give from k*(j+1) to k*(j+2)
+// power, linearly within each doubling
+func cappedLogPower(params Params, shares uint64) uint64 {
+	knee := params.PowerLogKnee
+	if knee == 0 {
+		knee = 1
+	}
+	if shares <= knee {
+		return shares
+	}
+
+	start, j := knee, uint(0)
+	for shares-start >= start {
+		start <<= 1
+		j++
+	}
+	return knee*uint64(j+1) + (shares-start)>>j
+}
+
+// isqrt - the largest integer whose square is at most n, by Newton's method
+// from a first guess above it
+func isqrt(n uint64) uint64 {
+	if n < 2 {
+		return n
+	}
+	x := uint64(1) << uint((bits.Len64(n)+1)/2)
+	for {
+		y := (x + n/x) / 2
+		if y >= x {
+			return x
+		}
+		x = y
+	}
+}
+
+//_________________________________________________________________________
+
+// capVotingPower - clip the voting power of the validators among the
+// candidates to the cap set by Params.MaxPowerFraction, keeping their power
+// before the cap as their RawPower, and save the candidates which changed
+func (cs Candidates) capVotingPower(store state.SimpleDB) {
+	var powers []uint64
+	for _, c := range cs {
+		if c.VotingPower != 0 {
+			powers = append(powers, c.VotingPower)
+		}
+	}
+	sort.Sort(sort.Reverse(uint64s(powers)))
+	limit := powerCap(powers, loadParams(store).MaxPowerFraction)
+
+	for _, c := range cs {
+		raw, power := c.VotingPower, c.VotingPower
+		if limit != 0 && power > limit {
+			power = limit
+		}
+		if c.RawPower == raw && c.VotingPower == power {
+			continue
+		}
+		c.RawPower, c.VotingPower = raw, power
+		saveCandidate(store, c)
+	}
+}
+
+// addsNoPower - whether delegating the shares to the candidate would leave
+// its voting power clipped by the Params.MaxPowerFraction cap, without adding
+// to it. The delegation also raises the total power and so the cap, so the
+// power is computed from the current candidates as the next update would, on
+// a throwaway copy of the store.
+func addsNoPower(store state.SimpleDB, candidate *Candidate, delegated uint64) (bool, error) {
+	if loadParams(store).MaxPowerFraction == 0 {
+		return false, nil
+	}
+	cache := store.Checkpoint()
+	defer cache.Discard()
+
+	// the candidate's power with the shares, capped and before the cap
+	power := func(shares uint64) (capped, raw uint64, err error) {
+		c := *candidate
+		c.Shares = shares
+		saveCandidate(cache, &c)
+		cs, err := loadCandidates(cache).updateVotingPower(cache)
+		if err != nil {
+			return 0, 0, err
+		}
+		cs.capVotingPower(cache)
+		updated := loadCandidate(cache, candidate.PubKey)
+		return updated.VotingPower, updated.RawPower, nil
+	}
+	before, _, err := power(candidate.Shares)
+	if err != nil {
+		return false, err
+	}
+	after, raw, err := power(candidate.Shares + delegated)
+	if err != nil {
+		return false, err
+	}
+	return after < raw && after <= before, nil
+}
+
+// capPower - clip the voting power of the validators to the cap set by the
+// fraction of their total, as for the candidates. The validators kept for
+// the update aren't candidates, so the cap is applied again to the whole
+// target set, which the churn limit then moves the validators towards.
+func (vs Validators) capPower(fraction uint64) {
+	powers := make([]uint64, len(vs))
+	for i, v := range vs {
+		powers[i] = v.VotingPower
+	}
+	sort.Sort(sort.Reverse(uint64s(powers)))
+	limit := powerCap(powers, fraction)
+	for i := range vs {
+		if limit != 0 && vs[i].VotingPower > limit {
+			vs[i].VotingPower = limit
+		}
+	}
+}
+
+// powerCap - the most voting power a validator may have so that none has
+// more than fraction basis points of the total power once capped, for the
+// powers sorted from the largest. With too few validators for any cap to do
+// that, the cap is the smallest power so they are all equal. A fraction of
+// zero doesn't cap anything and returns zero.
+func powerCap(powers []uint64, fraction uint64) uint64 {
+	if fraction == 0 || len(powers) == 0 {
+		return 0
+	}
+	smallest := powers[len(powers)-1]
+	if fraction*uint64(len(powers)) < maxRatio {
+		return smallest
+	}
+
+	var rest uint64
+	for _, p := range powers {
+		rest += p
+	}
+
+	// with the k largest powers capped, the cap is the fraction of the total
+	// of k caps and the rest, so it's fraction*rest/(1 - k*fraction)
+	for k, p := range powers {
+		if fraction*uint64(k) >= maxRatio {
+			// k equal validators have at most 1/k of the power each
+			return p
+		}
+		limit, _ := mulDiv(rest, fraction, maxRatio-fraction*uint64(k))
+		if p <= limit {
+			return limit
+		}
+		rest -= p
+	}
+	return smallest
+}
+
+// uint64s - sort.Interface for a list of powers
+type uint64s []uint64
+
+// nolint - sort interface functions
+func (p uint64s) Len() int           { return len(p) }
+func (p uint64s) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p uint64s) Less(i, j int) bool { return p[i] < p[j] }
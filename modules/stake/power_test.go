@@ -0,0 +1,174 @@
+package stake
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cosmos/cosmos-sdk/state"
+)
+
+func TestPowerFunctions(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	params := defaultParams()
+
+	cases := []struct {
+		name   string
+		shares uint64
+		power  uint64
+	}{
+		{PowerLinear, 1, 1},
+		{PowerLinear, 1000000, 1000000},
+		{PowerSqrt, 0, 0},
+		{PowerSqrt, 1, 1},
+		{PowerSqrt, 3, 1},
+		{PowerSqrt, 4, 2},
+		{PowerSqrt, 15, 3},
+		{PowerSqrt, 16, 4},
+		{PowerSqrt, 1000000000000, 1000000},
+		{PowerSqrt, 999999999999, 999999},
+		{PowerSqrt, math.MaxUint64, math.MaxUint32},
+		{PowerCappedLog, 1, 1},
+		{PowerCappedLog, 1000, 1000},
+		{PowerCappedLog, 1500, 1500},
+		{PowerCappedLog, 2000, 2000},
+		{PowerCappedLog, 3000, 2500},
+		{PowerCappedLog, 4000, 3000},
+		{PowerCappedLog, 1000000, 10953},
+		{PowerCappedLog, 1000000000000, 30862},
+		{PowerCappedLog, math.MaxUint64, 55023},
+	}
+	for _, tc := range cases {
+		power, err := GetPowerFunction(tc.name)
+		require.NoError(err)
+		assert.Equal(tc.power, power(params, tc.shares), "%s(%d)", tc.name, tc.shares)
+	}
+
+	// the knee is a param
+	params.PowerLogKnee = 10
+	power, err := GetPowerFunction(PowerCappedLog)
+	require.NoError(err)
+	assert.Equal(uint64(30), power(params, 40))
+
+	// an unknown function is an error, and can't be set at genesis
+	_, err = GetPowerFunction("unknown")
+	assert.Error(err)
+	store := state.NewMemKVStore()
+	handler := NewHandler()
+	assert.Error(handler.initState(stakingModuleName, "power_function", "unknown", store))
+	require.NoError(handler.initState(stakingModuleName, "power_function", PowerSqrt, store))
+	assert.Equal(PowerSqrt, loadParams(store).PowerFunction)
+
+	// and the validators get the power of the function
+	for _, c := range candidatesFromActors(newActors(2), []int{400, 100}) {
+		c.VotingPower = 0
+		saveCandidate(store, c)
+	}
+	change, err := UpdateValidatorSet(store, 1)
+	require.NoError(err)
+	require.Len(change, 2)
+	assert.Equal(uint64(20), loadCandidate(store, pks[0]).VotingPower)
+	assert.Equal(uint64(10), loadCandidate(store, pks[1]).VotingPower)
+}
+
+func TestPowerCap(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		powers   []uint64
+		fraction uint64
+		cap      uint64
+	}{
+		{[]uint64{900, 100, 100, 100}, 0, 0},           // no cap
+		{[]uint64{300, 300, 300, 100}, 3333, 333},      // nobody above the cap
+		{[]uint64{900, 100, 100, 100}, 3333, 149},      // 149 of 449
+		{[]uint64{900, 800, 100, 100, 100}, 3333, 299}, // 299 of 898
+		{[]uint64{900, 100}, 3333, 100},                // too few, all equal
+		{[]uint64{900, 100, 100}, 5000, 200},           // 200 of 400
+		{[]uint64{700}, 3333, 700},                     // a single validator
+		// large powers don't overflow
+		{[]uint64{9e18, 1e18, 1e18, 1e18}, 3333, 1499775011249437528},
+	}
+	for i, tc := range cases {
+		assert.Equal(tc.cap, powerCap(tc.powers, tc.fraction), "case %d", i)
+	}
+}
+
+func TestCapVotingPower(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	store := state.NewMemKVStore()
+	params := loadParams(store)
+	params.MaxPowerFraction = 3333
+	saveParams(store, params)
+
+	actors := newActors(5)
+	for _, c := range candidatesFromActors(actors[:4], []int{900, 100, 100, 100}) {
+		c.VotingPower = 0
+		saveCandidate(store, c)
+	}
+	change, err := UpdateValidatorSet(store, 1)
+	require.NoError(err)
+	require.Len(change, 4)
+
+	// the whale is clipped, and shows both powers
+	whale := loadCandidate(store, pks[0])
+	assert.Equal(uint64(149), whale.VotingPower)
+	assert.Equal(uint64(900), whale.RawPower)
+	assert.Equal(uint64(100), loadCandidate(store, pks[1]).RawPower)
+	assert.Equal([]ValidatorPower{{pks[0], 149}, {pks[1], 100}, {pks[2], 100},
+		{pks[3], 100}}, loadValidatorSet(store, 2))
+
+	// delegating to it would add no power, unless it's the owner's bond
+	checker := check{store: store, sender: actors[4]}
+	assert.Error(checker.delegate(newTxDelegate(10, pks[0])))
+	assert.NoError(checker.delegate(newTxDelegate(10, pks[1])))
+	checker.sender = actors[0]
+	assert.NoError(checker.delegate(newTxDelegate(10, pks[0])))
+
+	// the power is that of the current shares, not the last update's
+	whale.Shares = 100
+	saveCandidate(store, whale)
+	checker.sender = actors[4]
+	assert.NoError(checker.delegate(newTxDelegate(10, pks[0])))
+}
+
+func TestCapVotingPowerChurn(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	store := state.NewMemKVStore()
+
+	for _, c := range candidatesFromActors(newActors(4), []int{900, 100, 100, 100}) {
+		c.VotingPower = 0
+		saveCandidate(store, c)
+	}
+	_, err := UpdateValidatorSet(store, 1)
+	require.NoError(err)
+
+	// a cap set later caps the target, which the validators move towards
+	// within the churn limit, each update moving at most a third of the power
+	params := loadParams(store)
+	params.MaxPowerFraction = 3333
+	saveParams(store, params)
+	steps := []struct {
+		height int64
+		whale  int64
+	}{
+		{2, 900 - 399}, // of 1200 power before
+		{3, 501 - 266}, // of 801
+		{4, 149},       // of 535, the rest of the way
+	}
+	for _, step := range steps {
+		change, err := UpdateValidatorSet(store, step.height)
+		require.NoError(err)
+		require.Len(change, 1, "%d", step.height)
+		assert.Equal(step.whale, change[0].Power, "%d", step.height)
+	}
+	assert.Equal([]ValidatorPower{{pks[0], 149}, {pks[1], 100}, {pks[2], 100},
+		{pks[3], 100}}, loadValidatorSet(store, 5))
+
+	// and nothing changes once it's reached
+	change, err := UpdateValidatorSet(store, 5)
+	require.NoError(err)
+	assert.Empty(change)
+}
@@ -3,6 +3,7 @@ package rest
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/spf13/viper"
@@ -10,6 +11,7 @@ import (
 	"github.com/cosmos/cosmos-sdk/client"
 	"github.com/cosmos/cosmos-sdk/client/commands"
 	"github.com/cosmos/cosmos-sdk/client/commands/query"
+	"github.com/cosmos/cosmos-sdk/client/commands/search"
 	"github.com/cosmos/cosmos-sdk/modules/coin"
 	"github.com/cosmos/cosmos-sdk/stack"
 
@@ -48,6 +50,63 @@ func RegisterQueryDelegatorCandidates(r *mux.Router) error {
 	return nil
 }
 
+// RegisterQueryCandidateDelegators is a mux.Router handler that exposes GET
+// method access on route /query/stake/candidate/{pubkey}/delegators to query
+// a page of the candidate's delegators, selected by the start and limit url
+// query parameters
+func RegisterQueryCandidateDelegators(r *mux.Router) error {
+	r.HandleFunc("/query/stake/candidate/{pubkey}/delegators", queryCandidateDelegators).Methods("GET")
+	return nil
+}
+
+// RegisterQueryLiquidPool is a mux.Router handler that exposes GET method
+// access on route /query/stake/candidate/{pubkey}/pool to query the coins of
+// each delegator in the liquid pool of a candidate
+func RegisterQueryLiquidPool(r *mux.Router) error {
+	r.HandleFunc("/query/stake/candidate/{pubkey}/pool", queryLiquidPool).Methods("GET")
+	return nil
+}
+
+// RegisterQueryEpoch is a mux.Router handler that exposes GET method access
+// on route /query/stake/epoch to query the epoch of the next block and the
+// height its validator set update is made at
+func RegisterQueryEpoch(r *mux.Router) error {
+	r.HandleFunc("/query/stake/epoch", queryEpoch).Methods("GET")
+	return nil
+}
+
+// RegisterQueryValidators is a mux.Router handler that exposes GET method
+// access on route /query/stake/validators/{height} to query the validator set
+// which validated the block at a height
+func RegisterQueryValidators(r *mux.Router) error {
+	r.HandleFunc("/query/stake/validators/{height}", queryValidators).Methods("GET")
+	return nil
+}
+
+// RegisterQueryValidatorChanges is a mux.Router handler that exposes GET
+// method access on route /query/stake/validator_changes/{height} to query the
+// validator power changes made at a block height
+func RegisterQueryValidatorChanges(r *mux.Router) error {
+	r.HandleFunc("/query/stake/validator_changes/{height}", queryValidatorChanges).Methods("GET")
+	return nil
+}
+
+// RegisterQueryPoolChanges is a mux.Router handler that exposes GET method
+// access on route /query/stake/pool_changes/{height} to query the bonds moved
+// into or out of the liquid pools at a block height
+func RegisterQueryPoolChanges(r *mux.Router) error {
+	r.HandleFunc("/query/stake/pool_changes/{height}", queryPoolChanges).Methods("GET")
+	return nil
+}
+
+// RegisterSearchStake is a mux.Router handler that exposes GET method access
+// on route /tx/stake to search for stake txs by the delegator, pubkey and
+// action url query parameters
+func RegisterSearchStake(r *mux.Router) error {
+	r.HandleFunc("/tx/stake", searchStake).Methods("GET")
+	return nil
+}
+
 //---------------------------------------------------------------------
 
 // queryCandidate is the HTTP handlerfunc to query a candidate
@@ -86,6 +145,38 @@ func queryCandidate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// queryLiquidPool is the HTTP handlerfunc to query the liquid pool of a
+// candidate
+func queryLiquidPool(w http.ResponseWriter, r *http.Request) {
+
+	args := mux.Vars(r)
+	prove := !viper.GetBool(commands.FlagTrustNode) // from viper because defined when starting server
+
+	pkArg := args["pubkey"]
+	pk, err := scmds.GetPubKey(pkArg)
+	if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	var pool stake.LiquidPool
+	key := stack.PrefixedKey(stake.Name(), stake.GetLiquidPoolKey(pk))
+	height, err := query.GetParsed(key, &pool, query.GetHeight(), prove)
+	if client.IsNoDataErr(err) {
+		err := fmt.Errorf("no liquid pool for pubkey: %q", pkArg)
+		common.WriteError(w, err)
+		return
+	} else if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	err = query.FoutputProof(w, pool, height)
+	if err != nil {
+		common.WriteError(w, err)
+	}
+}
+
 // queryCandidates is the HTTP handlerfunc to query the group of all candidates
 func queryCandidates(w http.ResponseWriter, r *http.Request) {
 
@@ -186,3 +277,185 @@ func queryDelegatorCandidates(w http.ResponseWriter, r *http.Request) {
 		common.WriteError(w, err)
 	}
 }
+
+// queryCandidateDelegators is the HTTP handlerfunc to query a page of the
+// delegators of a candidate
+func queryCandidateDelegators(w http.ResponseWriter, r *http.Request) {
+
+	// get the arguments object
+	args := mux.Vars(r)
+
+	// get the pubkey
+	pk, err := scmds.GetPubKey(args["pubkey"])
+	if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	// get the page
+	params := r.URL.Query()
+	start, limit := 0, scmds.DefaultPageLimit
+	if arg := params.Get("start"); arg != "" {
+		if start, err = strconv.Atoi(arg); err != nil {
+			common.WriteError(w, fmt.Errorf("start must be an integer, got %q", arg))
+			return
+		}
+	}
+	if arg := params.Get("limit"); arg != "" {
+		if limit, err = strconv.Atoi(arg); err != nil {
+			common.WriteError(w, fmt.Errorf("limit must be an integer, got %q", arg))
+			return
+		}
+	}
+
+	page, height, err := scmds.GetCandidateDelegators(pk, start, limit, query.GetHeight())
+	if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	// write the output
+	err = query.FoutputProof(w, page, height)
+	if err != nil {
+		common.WriteError(w, err)
+	}
+}
+
+// queryEpoch is the HTTP handlerfunc to query the current epoch
+func queryEpoch(w http.ResponseWriter, r *http.Request) {
+	epoch, height, err := scmds.GetEpoch()
+	if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	// write the output
+	err = query.FoutputProof(w, epoch, height)
+	if err != nil {
+		common.WriteError(w, err)
+	}
+}
+
+// queryValidators is the HTTP handlerfunc to query the validator set of a
+// height
+func queryValidators(w http.ResponseWriter, r *http.Request) {
+
+	// get the arguments object
+	args := mux.Vars(r)
+
+	h, err := strconv.ParseInt(args["height"], 10, 64)
+	if err != nil || h <= 0 {
+		err := fmt.Errorf("height must be a positive integer, got %q", args["height"])
+		common.WriteError(w, err)
+		return
+	}
+
+	validators, height, err := scmds.GetValidatorSet(h)
+	if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	// write the output
+	err = query.FoutputProof(w, validators, height)
+	if err != nil {
+		common.WriteError(w, err)
+	}
+}
+
+// queryValidatorChanges is the HTTP handlerfunc to query the validator power
+// changes at a height
+func queryValidatorChanges(w http.ResponseWriter, r *http.Request) {
+
+	// get the arguments object
+	args := mux.Vars(r)
+	prove := !viper.GetBool(commands.FlagTrustNode) // from viper because defined when starting server
+
+	h, err := strconv.ParseInt(args["height"], 10, 64)
+	if err != nil || h <= 0 {
+		err := fmt.Errorf("height must be a positive integer, got %q", args["height"])
+		common.WriteError(w, err)
+		return
+	}
+
+	// the changes are stored by height, so can be read from the latest state
+	var changes []stake.ValidatorChange
+	key := stack.PrefixedKey(stake.Name(), stake.GetValidatorChangesKey(h))
+	height, err := query.GetParsed(key, &changes, 0, prove)
+	if client.IsNoDataErr(err) {
+		changes, err = nil, nil // no changes at this height
+	}
+	if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	// write the output
+	err = query.FoutputProof(w, changes, height)
+	if err != nil {
+		common.WriteError(w, err)
+	}
+}
+
+// queryPoolChanges is the HTTP handlerfunc to query the liquid pool changes
+// at a height
+func queryPoolChanges(w http.ResponseWriter, r *http.Request) {
+
+	// get the arguments object
+	args := mux.Vars(r)
+	prove := !viper.GetBool(commands.FlagTrustNode) // from viper because defined when starting server
+
+	h, err := strconv.ParseInt(args["height"], 10, 64)
+	if err != nil || h <= 0 {
+		err := fmt.Errorf("height must be a positive integer, got %q", args["height"])
+		common.WriteError(w, err)
+		return
+	}
+
+	// the changes are stored by height, so can be read from the latest state
+	var changes []stake.PoolChange
+	key := stack.PrefixedKey(stake.Name(), stake.GetPoolChangesKey(h))
+	height, err := query.GetParsed(key, &changes, 0, prove)
+	if client.IsNoDataErr(err) {
+		changes, err = nil, nil // no changes at this height
+	}
+	if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	// write the output
+	err = query.FoutputProof(w, changes, height)
+	if err != nil {
+		common.WriteError(w, err)
+	}
+}
+
+// searchStake is the HTTP handlerfunc to search for stake txs by tags
+func searchStake(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q, err := scmds.StakeSearchQuery(params.Get("delegator"), params.Get("pubkey"),
+		params.Get("action"), 0, 0)
+	if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	prove := !viper.GetBool(commands.FlagTrustNode)
+	all, err := search.FindAnyTx(prove, q)
+	if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	output, err := search.FormatSearch(all, scmds.ExtractStakeTx)
+	if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	// display
+	if err := search.Foutput(w, output); err != nil {
+		common.WriteError(w, err)
+	}
+}
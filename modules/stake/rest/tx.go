@@ -16,6 +16,7 @@ import (
 	"github.com/cosmos/cosmos-sdk/modules/fee"
 	"github.com/cosmos/cosmos-sdk/modules/nonce"
 	"github.com/cosmos/gaia/modules/stake"
+	scmds "github.com/cosmos/gaia/modules/stake/commands"
 )
 
 const (
@@ -45,7 +46,56 @@ type unbondInput struct {
 
 	Pubkey crypto.PubKey `json:"pub_key"`
 	From   *sdk.Actor    `json:"from"`
-	Amount uint64        `json:"amount"`
+
+	// exactly one of the following must be set
+	Amount uint64     `json:"amount"` // raw shares to unbond
+	Coins  *coin.Coin `json:"coins"`  // coins to unbond, converted to shares
+	All    bool       `json:"all"`    // unbond all shares
+}
+
+type batchInput struct {
+	Fees     *coin.Coin `json:"fees"`
+	Sequence uint32     `json:"sequence"`
+
+	From *sdk.Actor      `json:"from"`
+	Txs  []scmds.BatchOp `json:"txs"`
+}
+
+type revokeInput struct {
+	Fees     *coin.Coin `json:"fees"`
+	Sequence uint32     `json:"sequence"`
+
+	Pubkey crypto.PubKey `json:"pub_key"`
+	From   *sdk.Actor    `json:"from"`
+}
+
+type withdrawPoolInput struct {
+	Fees     *coin.Coin `json:"fees"`
+	Sequence uint32     `json:"sequence"`
+
+	Pubkey crypto.PubKey `json:"pub_key"`
+	From   *sdk.Actor    `json:"from"`
+}
+
+type rotateKeyInput struct {
+	Fees     *coin.Coin `json:"fees"`
+	Sequence uint32     `json:"sequence"`
+
+	Pubkey    crypto.PubKey `json:"pub_key"`
+	NewPubkey crypto.PubKey `json:"new_pub_key"`
+	From      *sdk.Actor    `json:"from"`
+
+	// by the new pubkey over stake.CandidacySignBytes of the chain and owner
+	NewPubkeySig crypto.Signature `json:"new_pub_key_sig"`
+}
+
+type transferOwnerInput struct {
+	Fees     *coin.Coin `json:"fees"`
+	Sequence uint32     `json:"sequence"`
+
+	Pubkey   crypto.PubKey `json:"pub_key"`
+	NewOwner *sdk.Actor    `json:"new_owner"`
+	From     *sdk.Actor    `json:"from"`
 }
 
 // RegisterDelegate is a mux.Router handler that exposes
@@ -64,6 +114,46 @@ func RegisterUnbond(r *mux.Router) error {
 	return nil
 }
 
+// RegisterBatch is a mux.Router handler that exposes
+// POST method access on route /build/stake/batch to create a
+// transaction applying several delegations, unbonds and edits atomically
+func RegisterBatch(r *mux.Router) error {
+	r.HandleFunc("/build/stake/batch", batch).Methods("POST")
+	return nil
+}
+
+// RegisterRevokeCandidacy is a mux.Router handler that exposes
+// POST method access on route /build/stake/revoke-candidacy to create a
+// transaction withdrawing a candidate and unbonding all its delegators
+func RegisterRevokeCandidacy(r *mux.Router) error {
+	r.HandleFunc("/build/stake/revoke-candidacy", revokeCandidacy).Methods("POST")
+	return nil
+}
+
+// RegisterWithdrawPool is a mux.Router handler that exposes
+// POST method access on route /build/stake/withdraw-pool to create a
+// transaction taking the sender's coins out of a candidate's liquid pool
+func RegisterWithdrawPool(r *mux.Router) error {
+	r.HandleFunc("/build/stake/withdraw-pool", withdrawPool).Methods("POST")
+	return nil
+}
+
+// RegisterRotateConsensusKey is a mux.Router handler that exposes
+// POST method access on route /build/stake/rotate-consensus-key to create a
+// transaction moving a candidate to a new consensus pubkey
+func RegisterRotateConsensusKey(r *mux.Router) error {
+	r.HandleFunc("/build/stake/rotate-consensus-key", rotateConsensusKey).Methods("POST")
+	return nil
+}
+
+// RegisterTransferOwnership is a mux.Router handler that exposes
+// POST method access on route /build/stake/transfer-ownership to create a
+// transaction handing a candidate over to a new owner
+func RegisterTransferOwnership(r *mux.Router) error {
+	r.HandleFunc("/build/stake/transfer-ownership", transferOwnership).Methods("POST")
+	return nil
+}
+
 func prepareDelegateTx(di *delegateInput) sdk.Tx {
 	tx := stake.NewTxDelegate(di.Amount, di.Pubkey)
 	// fees are optional
@@ -111,8 +201,17 @@ func delegate(w http.ResponseWriter, r *http.Request) {
 	common.WriteSuccess(w, tx)
 }
 
-func prepareUnbondTx(ui *unbondInput) sdk.Tx {
-	tx := stake.NewTxUnbond(ui.Amount, ui.Pubkey)
+func prepareUnbondTx(ui *unbondInput) (sdk.Tx, error) {
+	shares := ui.Amount
+	if ui.Coins != nil || ui.All {
+		var err error
+		shares, err = scmds.GetUnbondShares(*ui.From, ui.Pubkey, ui.Coins)
+		if err != nil {
+			return sdk.Tx{}, err
+		}
+	}
+
+	tx := stake.NewTxUnbond(shares, ui.Pubkey)
 	// fees are optional
 	if ui.Fees != nil && !ui.Fees.IsZero() {
 		tx = fee.NewFee(tx, *ui.Fees, *ui.From)
@@ -123,7 +222,7 @@ func prepareUnbondTx(ui *unbondInput) sdk.Tx {
 	tx = base.NewChainTx(commands.GetChainID(), 0, tx)
 
 	tx = auth.NewSig(tx).Wrap()
-	return tx
+	return tx, nil
 }
 
 func unbond(w http.ResponseWriter, r *http.Request) {
@@ -144,6 +243,270 @@ func unbond(w http.ResponseWriter, r *http.Request) {
 	if ui.Pubkey.Empty() {
 		errsList = append(errsList, `"pubkey" cannot be empty`)
 	}
+	set := 0
+	for _, isSet := range []bool{ui.Amount != 0, ui.Coins != nil, ui.All} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		errsList = append(errsList, `exactly one of "amount", "coins" and "all" must be set`)
+	}
+	if len(errsList) > 0 {
+		code := http.StatusBadRequest
+		err := &common.ErrorResponse{
+			Err:  strings.Join(errsList, ", "),
+			Code: code,
+		}
+		common.WriteCode(w, err, code)
+		return
+	}
+
+	tx, err := prepareUnbondTx(ui)
+	if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+	common.WriteSuccess(w, tx)
+}
+
+func prepareBatchTx(bi *batchInput) (sdk.Tx, error) {
+	tx, err := scmds.NewTxStakeBatch(*bi.From, bi.Txs)
+	if err != nil {
+		return sdk.Tx{}, err
+	}
+	// fees are optional
+	if bi.Fees != nil && !bi.Fees.IsZero() {
+		tx = fee.NewFee(tx, *bi.Fees, *bi.From)
+	}
+	// only add the actual signer to the nonce
+	signers := []sdk.Actor{*bi.From}
+	tx = nonce.NewTx(bi.Sequence, signers, tx)
+	tx = base.NewChainTx(commands.GetChainID(), 0, tx)
+
+	tx = auth.NewSig(tx).Wrap()
+	return tx, nil
+}
+
+func batch(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	bi := new(batchInput)
+	if err := common.ParseRequestAndValidateJSON(r, bi); err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	var errsList []string
+	if bi.From == nil {
+		errsList = append(errsList, `"from" cannot be nil`)
+	}
+	if bi.Sequence <= 0 {
+		errsList = append(errsList, `"sequence" must be > 0`)
+	}
+	if len(bi.Txs) == 0 {
+		errsList = append(errsList, `"txs" cannot be empty`)
+	}
+	if len(errsList) > 0 {
+		code := http.StatusBadRequest
+		err := &common.ErrorResponse{
+			Err:  strings.Join(errsList, ", "),
+			Code: code,
+		}
+		common.WriteCode(w, err, code)
+		return
+	}
+
+	tx, err := prepareBatchTx(bi)
+	if err != nil {
+		common.WriteError(w, err)
+		return
+	}
+	common.WriteSuccess(w, tx)
+}
+
+func prepareRevokeTx(ri *revokeInput) sdk.Tx {
+	tx := stake.NewTxRevokeCandidacy(ri.Pubkey)
+	// fees are optional
+	if ri.Fees != nil && !ri.Fees.IsZero() {
+		tx = fee.NewFee(tx, *ri.Fees, *ri.From)
+	}
+	// only add the actual signer to the nonce
+	signers := []sdk.Actor{*ri.From}
+	tx = nonce.NewTx(ri.Sequence, signers, tx)
+	tx = base.NewChainTx(commands.GetChainID(), 0, tx)
+
+	tx = auth.NewSig(tx).Wrap()
+	return tx
+}
+
+func revokeCandidacy(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ri := new(revokeInput)
+	if err := common.ParseRequestAndValidateJSON(r, ri); err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	var errsList []string
+	if ri.From == nil {
+		errsList = append(errsList, `"from" cannot be nil`)
+	}
+	if ri.Sequence <= 0 {
+		errsList = append(errsList, `"sequence" must be > 0`)
+	}
+	if ri.Pubkey.Empty() {
+		errsList = append(errsList, `"pub_key" cannot be empty`)
+	}
+	if len(errsList) > 0 {
+		code := http.StatusBadRequest
+		err := &common.ErrorResponse{
+			Err:  strings.Join(errsList, ", "),
+			Code: code,
+		}
+		common.WriteCode(w, err, code)
+		return
+	}
+
+	tx := prepareRevokeTx(ri)
+	common.WriteSuccess(w, tx)
+}
+
+func prepareWithdrawPoolTx(wi *withdrawPoolInput) sdk.Tx {
+	tx := stake.NewTxWithdrawPool(wi.Pubkey)
+	// fees are optional
+	if wi.Fees != nil && !wi.Fees.IsZero() {
+		tx = fee.NewFee(tx, *wi.Fees, *wi.From)
+	}
+	// only add the actual signer to the nonce
+	signers := []sdk.Actor{*wi.From}
+	tx = nonce.NewTx(wi.Sequence, signers, tx)
+	tx = base.NewChainTx(commands.GetChainID(), 0, tx)
+
+	tx = auth.NewSig(tx).Wrap()
+	return tx
+}
+
+func withdrawPool(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	wi := new(withdrawPoolInput)
+	if err := common.ParseRequestAndValidateJSON(r, wi); err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	var errsList []string
+	if wi.From == nil {
+		errsList = append(errsList, `"from" cannot be nil`)
+	}
+	if wi.Sequence <= 0 {
+		errsList = append(errsList, `"sequence" must be > 0`)
+	}
+	if wi.Pubkey.Empty() {
+		errsList = append(errsList, `"pub_key" cannot be empty`)
+	}
+	if len(errsList) > 0 {
+		code := http.StatusBadRequest
+		err := &common.ErrorResponse{
+			Err:  strings.Join(errsList, ", "),
+			Code: code,
+		}
+		common.WriteCode(w, err, code)
+		return
+	}
+
+	tx := prepareWithdrawPoolTx(wi)
+	common.WriteSuccess(w, tx)
+}
+
+func prepareRotateKeyTx(ri *rotateKeyInput) sdk.Tx {
+	tx := stake.NewTxRotateConsensusKey(ri.Pubkey, ri.NewPubkey, ri.NewPubkeySig)
+	// fees are optional
+	if ri.Fees != nil && !ri.Fees.IsZero() {
+		tx = fee.NewFee(tx, *ri.Fees, *ri.From)
+	}
+	// only add the actual signer to the nonce
+	signers := []sdk.Actor{*ri.From}
+	tx = nonce.NewTx(ri.Sequence, signers, tx)
+	tx = base.NewChainTx(commands.GetChainID(), 0, tx)
+
+	tx = auth.NewSig(tx).Wrap()
+	return tx
+}
+
+func rotateConsensusKey(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ri := new(rotateKeyInput)
+	if err := common.ParseRequestAndValidateJSON(r, ri); err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	var errsList []string
+	if ri.From == nil {
+		errsList = append(errsList, `"from" cannot be nil`)
+	}
+	if ri.Sequence <= 0 {
+		errsList = append(errsList, `"sequence" must be > 0`)
+	}
+	if ri.Pubkey.Empty() {
+		errsList = append(errsList, `"pub_key" cannot be empty`)
+	}
+	if ri.NewPubkey.Empty() {
+		errsList = append(errsList, `"new_pub_key" cannot be empty`)
+	}
+	if ri.NewPubkeySig.Empty() {
+		errsList = append(errsList, `"new_pub_key_sig" cannot be empty`)
+	}
+	if len(errsList) > 0 {
+		code := http.StatusBadRequest
+		err := &common.ErrorResponse{
+			Err:  strings.Join(errsList, ", "),
+			Code: code,
+		}
+		common.WriteCode(w, err, code)
+		return
+	}
+
+	tx := prepareRotateKeyTx(ri)
+	common.WriteSuccess(w, tx)
+}
+
+func prepareTransferOwnerTx(ti *transferOwnerInput) sdk.Tx {
+	tx := stake.NewTxTransferOwnership(ti.Pubkey, *ti.NewOwner)
+	// fees are optional
+	if ti.Fees != nil && !ti.Fees.IsZero() {
+		tx = fee.NewFee(tx, *ti.Fees, *ti.From)
+	}
+	// only add the actual signer to the nonce
+	signers := []sdk.Actor{*ti.From}
+	tx = nonce.NewTx(ti.Sequence, signers, tx)
+	tx = base.NewChainTx(commands.GetChainID(), 0, tx)
+
+	tx = auth.NewSig(tx).Wrap()
+	return tx
+}
+
+func transferOwnership(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	ti := new(transferOwnerInput)
+	if err := common.ParseRequestAndValidateJSON(r, ti); err != nil {
+		common.WriteError(w, err)
+		return
+	}
+
+	var errsList []string
+	if ti.From == nil {
+		errsList = append(errsList, `"from" cannot be nil`)
+	}
+	if ti.Sequence <= 0 {
+		errsList = append(errsList, `"sequence" must be > 0`)
+	}
+	if ti.Pubkey.Empty() {
+		errsList = append(errsList, `"pub_key" cannot be empty`)
+	}
+	if ti.NewOwner == nil || ti.NewOwner.Empty() {
+		errsList = append(errsList, `"new_owner" cannot be empty`)
+	}
 	if len(errsList) > 0 {
 		code := http.StatusBadRequest
 		err := &common.ErrorResponse{
@@ -154,6 +517,6 @@ func unbond(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tx := prepareUnbondTx(ui)
+	tx := prepareTransferOwnerTx(ti)
 	common.WriteSuccess(w, tx)
 }
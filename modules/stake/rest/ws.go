@@ -0,0 +1,346 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+
+	rpcclient "github.com/tendermint/tendermint/rpc/client"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"github.com/tendermint/tmlibs/log"
+
+	"github.com/cosmos/cosmos-sdk/client"
+	"github.com/cosmos/cosmos-sdk/client/commands"
+	"github.com/cosmos/cosmos-sdk/client/commands/query"
+	"github.com/cosmos/cosmos-sdk/stack"
+
+	"github.com/cosmos/gaia/modules/stake"
+	scmds "github.com/cosmos/gaia/modules/stake/commands"
+)
+
+// FlagWSOrigins - the comma separated origins allowed to open a websocket,
+// any for "*", only the server's own if empty
+const FlagWSOrigins = "ws-origins"
+
+const (
+	wsSubscriber = "gaia-rest-stake"
+
+	// types of the events pushed to websocket clients
+	wsEventTx        = "tx"
+	wsEventValidator = "validator"
+	wsEventPool      = "pool"
+
+	wsClientBuffer = 100 // events queued per client before it is dropped
+)
+
+// wsEvent is the message pushed to websocket clients, either a stake action
+// of a tx, a change of a validator's power or a bond moved into or out of a
+// liquid pool
+type wsEvent struct {
+	Type      string                 `json:"type"`
+	Height    int64                  `json:"height"`
+	TxHash    string                 `json:"tx_hash,omitempty"`
+	Tx        *stake.TxEvent         `json:"tx,omitempty"`
+	Validator *stake.ValidatorChange `json:"validator,omitempty"`
+	Pool      *stake.PoolChange      `json:"pool,omitempty"`
+}
+
+// RegisterWebsocket is a mux.Router handler that exposes websocket access on
+// route /ws/stake to receive stake events as they are committed. The optional
+// pubkey and delegator url query parameters only send the events for that
+// candidate or delegator, validator changes have no delegator. Browsers may
+// only connect from the origins of FlagWSOrigins.
+func RegisterWebsocket(r *mux.Router) error {
+	hub := &wsHub{
+		node:         commands.GetNode(),
+		logger:       log.NewTMLogger(log.NewSyncWriter(os.Stdout)).With("module", "rest-stake-ws"),
+		queryChanges: queryValidatorChangesAt,
+		queryPool:    queryPoolChangesAt,
+		clients:      make(map[*wsClient]bool),
+	}
+	hub.upgrader.CheckOrigin = checkOrigin(viper.GetString(FlagWSOrigins))
+	r.HandleFunc("/ws/stake", hub.serveWS)
+	return nil
+}
+
+// checkOrigin - allow the listed origins, any for "*", or only the request's
+// host if none are. Requests without an origin don't come from a browser.
+func checkOrigin(origins string) func(r *http.Request) bool {
+	allowed := make(map[string]bool)
+	for _, o := range strings.Split(origins, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			allowed[strings.ToLower(o)] = true
+		}
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowed["*"] || allowed[strings.ToLower(origin)] {
+			return true
+		}
+		if len(allowed) > 0 {
+			return false
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+//---------------------------------------------------------------------
+
+// wsHub holds one subscription to the node's events, which is started with
+// the first websocket client, and fans the stake events out to all clients
+type wsHub struct {
+	node     rpcclient.Client
+	logger   log.Logger
+	upgrader websocket.Upgrader
+
+	// the validator and pool changes stored at a height, proven at that height
+	queryChanges func(height int64) ([]stake.ValidatorChange, error)
+	queryPool    func(height int64) ([]stake.PoolChange, error)
+
+	mtx        sync.Mutex
+	subscribed bool
+	clients    map[*wsClient]bool
+}
+
+type wsClient struct {
+	conn      *websocket.Conn
+	send      chan wsEvent
+	candidate string // pubkey KeyString, empty for all
+	delegator string // actor String, empty for all
+}
+
+func (h *wsHub) serveWS(w http.ResponseWriter, r *http.Request) {
+	c := &wsClient{send: make(chan wsEvent, wsClientBuffer)}
+
+	params := r.URL.Query()
+	if pkArg := params.Get("pubkey"); pkArg != "" {
+		pk, err := scmds.GetPubKey(pkArg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.candidate = pk.KeyString()
+	}
+	if addr := params.Get("delegator"); addr != "" {
+		delegator, err := commands.ParseActor(addr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.delegator = delegator.String()
+	}
+
+	err := h.subscribe()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot subscribe to node events: %v", err),
+			http.StatusServiceUnavailable)
+		return
+	}
+
+	c.conn, err = h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // the upgrader already replied with the error
+	}
+
+	h.mtx.Lock()
+	h.clients[c] = true
+	h.mtx.Unlock()
+
+	go c.writePump()
+	c.readPump()
+
+	h.remove(c)
+}
+
+// subscribe to the node's tx and block header events, once
+func (h *wsHub) subscribe() error {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if h.subscribed {
+		return nil
+	}
+	if !h.node.IsRunning() {
+		if err := h.node.Start(); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	txs := make(chan interface{}, wsClientBuffer)
+	err := h.node.Subscribe(ctx, wsSubscriber, tmtypes.EventQueryTx, txs)
+	if err != nil {
+		return err
+	}
+	headers := make(chan interface{}, wsClientBuffer)
+	err = h.node.Subscribe(ctx, wsSubscriber, tmtypes.EventQueryNewBlockHeader, headers)
+	if err != nil {
+		h.node.Unsubscribe(ctx, wsSubscriber, tmtypes.EventQueryTx)
+		return err
+	}
+
+	go h.handleTxs(txs)
+	go h.handleHeaders(headers)
+	h.subscribed = true
+	return nil
+}
+
+func (h *wsHub) remove(c *wsClient) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+// broadcast the event to the clients whose filters match, clients too slow to
+// keep up are dropped
+func (h *wsHub) broadcast(e wsEvent, candidate, delegator string) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	for c := range h.clients {
+		if c.candidate != "" && c.candidate != candidate {
+			continue
+		}
+		if c.delegator != "" && c.delegator != delegator {
+			continue
+		}
+		select {
+		case c.send <- e:
+		default:
+			delete(h.clients, c)
+			close(c.send)
+		}
+	}
+}
+
+func (h *wsHub) hasClients() bool {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return len(h.clients) > 0
+}
+
+// push the stake actions of each committed tx, read from its tags
+func (h *wsHub) handleTxs(txs <-chan interface{}) {
+	for data := range txs {
+		ed, ok := data.(tmtypes.TMEventData)
+		if !ok {
+			continue
+		}
+		tx, ok := ed.Unwrap().(tmtypes.EventDataTx)
+		if !ok || tx.Result.IsErr() {
+			continue
+		}
+		hash := fmt.Sprintf("%X", tx.Tx.Hash())
+		for _, e := range stake.TxEvents(tx.Result.Tags) {
+			e := e
+			h.broadcast(wsEvent{
+				Type:   wsEventTx,
+				Height: tx.Height,
+				TxHash: hash,
+				Tx:     &e,
+			}, e.Candidate, e.Delegator)
+		}
+	}
+}
+
+// push the validator and pool changes recorded at the end of the previous
+// block with each new block header, which carries the app hash proving them
+func (h *wsHub) handleHeaders(headers <-chan interface{}) {
+	for data := range headers {
+		ed, ok := data.(tmtypes.TMEventData)
+		if !ok {
+			continue
+		}
+		header, ok := ed.Unwrap().(tmtypes.EventDataNewBlockHeader)
+		if !ok || header.Header == nil || !h.hasClients() {
+			continue
+		}
+
+		height := header.Header.Height - 1
+		if height <= 0 {
+			continue
+		}
+		changes, err := h.queryChanges(height)
+		if err != nil {
+			h.logger.Error("Cannot query the validator changes", "height", height, "err", err)
+			continue
+		}
+		for _, c := range changes {
+			c := c
+			h.broadcast(wsEvent{
+				Type:      wsEventValidator,
+				Height:    height,
+				Validator: &c,
+			}, c.PubKey.KeyString(), "")
+		}
+
+		pool, err := h.queryPool(height)
+		if err != nil {
+			h.logger.Error("Cannot query the pool changes", "height", height, "err", err)
+			continue
+		}
+		for _, p := range pool {
+			p := p
+			h.broadcast(wsEvent{
+				Type:   wsEventPool,
+				Height: height,
+				Pool:   &p,
+			}, p.PubKey.KeyString(), p.Delegator.String())
+		}
+	}
+}
+
+func queryValidatorChangesAt(height int64) (changes []stake.ValidatorChange, err error) {
+	prove := !viper.GetBool(commands.FlagTrustNode) // from viper because defined when starting server
+	key := stack.PrefixedKey(stake.Name(), stake.GetValidatorChangesKey(height))
+	_, err = query.GetParsed(key, &changes, height, prove)
+	if client.IsNoDataErr(err) {
+		return nil, nil // no changes at this height
+	}
+	return
+}
+
+func queryPoolChangesAt(height int64) (changes []stake.PoolChange, err error) {
+	prove := !viper.GetBool(commands.FlagTrustNode) // from viper because defined when starting server
+	key := stack.PrefixedKey(stake.Name(), stake.GetPoolChangesKey(height))
+	_, err = query.GetParsed(key, &changes, height, prove)
+	if client.IsNoDataErr(err) {
+		return nil, nil // no changes at this height
+	}
+	return
+}
+
+//---------------------------------------------------------------------
+
+// writePump writes the events queued for the client until the hub closes
+// the queue or the connection fails
+func (c *wsClient) writePump() {
+	defer c.conn.Close()
+	for e := range c.send {
+		if err := c.conn.WriteJSON(e); err != nil {
+			return
+		}
+	}
+	c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+}
+
+// readPump discards incoming messages and returns once the client is gone
+func (c *wsClient) readPump() {
+	defer c.conn.Close()
+	for {
+		if _, _, err := c.conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
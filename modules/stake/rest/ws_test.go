@@ -0,0 +1,144 @@
+package rest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	crypto "github.com/tendermint/go-crypto"
+	tmtypes "github.com/tendermint/tendermint/types"
+	"github.com/tendermint/tmlibs/log"
+
+	sdk "github.com/cosmos/cosmos-sdk"
+
+	"github.com/cosmos/gaia/modules/stake"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	assert := assert.New(t)
+
+	request := func(host, origin string) *http.Request {
+		r := &http.Request{Host: host, Header: http.Header{}}
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+
+	cases := []struct {
+		origins string
+		r       *http.Request
+		allowed bool
+	}{
+		// only the server's own origin by default
+		{"", request("localhost:8998", ""), true},
+		{"", request("localhost:8998", "http://localhost:8998"), true},
+		{"", request("localhost:8998", "http://evil.com"), false},
+		// the listed origins
+		{"http://wallet.io, https://app.io", request("localhost:8998", "https://app.io"), true},
+		{"http://wallet.io, https://app.io", request("localhost:8998", "http://localhost:8998"), false},
+		{"http://wallet.io", request("localhost:8998", "http://evil.com"), false},
+		// or any
+		{"*", request("localhost:8998", "http://evil.com"), true},
+	}
+	for i, tc := range cases {
+		assert.Equal(tc.allowed, checkOrigin(tc.origins)(tc.r), "%d", i)
+	}
+}
+
+func newTestClient(candidate, delegator string, buffer int) *wsClient {
+	return &wsClient{
+		send:      make(chan wsEvent, buffer),
+		candidate: candidate,
+		delegator: delegator,
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	assert := assert.New(t)
+
+	all := newTestClient("", "", 10)
+	byCandidate := newTestClient("pk1", "", 10)
+	byDelegator := newTestClient("", "alice", 10)
+	slow := newTestClient("", "", 1)
+	hub := &wsHub{clients: map[*wsClient]bool{
+		all: true, byCandidate: true, byDelegator: true, slow: true,
+	}}
+
+	hub.broadcast(wsEvent{Height: 1}, "pk1", "alice")
+	hub.broadcast(wsEvent{Height: 2}, "pk2", "bob")
+	hub.broadcast(wsEvent{Height: 3}, "pk2", "")
+
+	heights := func(c *wsClient) (hs []int64) {
+		for len(c.send) > 0 {
+			hs = append(hs, (<-c.send).Height)
+		}
+		return
+	}
+	assert.Equal([]int64{1, 2, 3}, heights(all))
+	assert.Equal([]int64{1}, heights(byCandidate))
+	assert.Equal([]int64{1}, heights(byDelegator))
+
+	// the slow client's queue filled up, so it was dropped
+	assert.False(hub.clients[slow])
+	assert.Equal([]int64{1}, heights(slow))
+	_, open := <-slow.send
+	assert.False(open)
+}
+
+func TestHandleHeaders(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+
+	pk := crypto.GenPrivKeyEd25519().PubKey()
+	alice := sdk.NewActor("sig", []byte("alice"))
+	var queried []int64
+	client := newTestClient("", "", 10)
+	byDelegator := newTestClient("", alice.String(), 10)
+	hub := &wsHub{
+		logger: log.NewNopLogger(),
+		queryChanges: func(height int64) ([]stake.ValidatorChange, error) {
+			queried = append(queried, height)
+			return []stake.ValidatorChange{{PubKey: pk, After: uint64(height)}}, nil
+		},
+		queryPool: func(height int64) ([]stake.PoolChange, error) {
+			return []stake.PoolChange{{
+				PubKey:    pk,
+				Delegator: alice,
+				Action:    stake.ActionPool,
+				Amount:    height,
+			}}, nil
+		},
+		clients: map[*wsClient]bool{client: true, byDelegator: true},
+	}
+
+	headers := make(chan interface{}, 2)
+	for _, height := range []int64{1, 5} {
+		headers <- tmtypes.TMEventData{TMEventDataInner: tmtypes.EventDataNewBlockHeader{
+			Header: &tmtypes.Header{Height: height},
+		}}
+	}
+	close(headers)
+	hub.handleHeaders(headers)
+
+	// each header proves the changes at the end of the block before it
+	assert.Equal([]int64{4}, queried)
+	require.Len(client.send, 2)
+	e := <-client.send
+	assert.Equal(wsEventValidator, e.Type)
+	assert.Equal(int64(4), e.Height)
+	require.NotNil(e.Validator)
+	assert.Equal(uint64(4), e.Validator.After)
+	e = <-client.send
+	assert.Equal(wsEventPool, e.Type)
+	require.NotNil(e.Pool)
+	assert.Equal(int64(4), e.Pool.Amount)
+
+	// the pool changes have a delegator to filter on
+	require.Len(byDelegator.send, 1)
+	e = <-byDelegator.send
+	assert.Equal(wsEventPool, e.Type)
+	require.NotNil(e.Pool)
+	assert.True(alice.Equals(e.Pool.Delegator))
+}
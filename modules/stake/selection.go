@@ -0,0 +1,107 @@
+package stake
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/cosmos/cosmos-sdk/state"
+)
+
+// Names of the built-in validator selection policies
+const (
+	// SelectionPubKey - the original rule, equal voting power is ordered by
+	// the pubkey bytes
+	SelectionPubKey = "pubkey"
+	// SelectionEarliest - equal voting power is ordered by the earliest
+	// declaration height, so ties can't be won by grinding keys
+	SelectionEarliest = "earliest-declared"
+)
+
+// SelectionPolicy - decides which candidates may be validators and how
+// candidates of equal voting power are ordered for the MaxVals cutoff. The
+// policy in use is named by Params.SelectionPolicy. Only the candidates
+// which hasMinSelfBond are asked whether they're eligible.
+type SelectionPolicy interface {
+	// Eligible - whether the candidate may be a validator at all
+	Eligible(store state.SimpleDB, params Params, candidate *Candidate) bool
+	// Less - whether c1 comes before c2, both having equal voting power
+	Less(c1, c2 *Candidate) bool
+}
+
+var selectionPolicies = map[string]SelectionPolicy{
+	SelectionPubKey:   pubKeyPolicy{},
+	SelectionEarliest: earliestPolicy{},
+}
+
+// RegisterSelectionPolicy - make a policy available to Params.SelectionPolicy,
+// to be called from an init function
+func RegisterSelectionPolicy(name string, policy SelectionPolicy) {
+	if _, ok := selectionPolicies[name]; ok {
+		panic(fmt.Sprintf("selection policy %q is already registered", name))
+	}
+	selectionPolicies[name] = policy
+}
+
+// GetSelectionPolicy - get the policy registered with the name
+func GetSelectionPolicy(name string) (SelectionPolicy, error) {
+	policy, ok := selectionPolicies[name]
+	if !ok {
+		return nil, ErrUnknownSelectionPolicy(name)
+	}
+	return policy, nil
+}
+
+// sort the candidates by voting power, the ties ordered by the policy
+type byPolicy struct {
+	Candidates
+	policy SelectionPolicy
+}
+
+func (cs byPolicy) Less(i, j int) bool {
+	vp1, vp2 := cs.Candidates[i].VotingPower, cs.Candidates[j].VotingPower
+	if vp1 != vp2 {
+		return vp1 > vp2
+	}
+	return cs.policy.Less(cs.Candidates[i], cs.Candidates[j])
+}
+
+func (cs Candidates) sortByPolicy(policy SelectionPolicy) {
+	sort.Sort(byPolicy{cs, policy})
+}
+
+//_________________________________________________________________________
+
+type pubKeyPolicy struct{}
+
+func (pubKeyPolicy) Eligible(state.SimpleDB, Params, *Candidate) bool { return true }
+
+func (pubKeyPolicy) Less(c1, c2 *Candidate) bool {
+	return bytes.Compare(pubKeyBytes(c1.PubKey), pubKeyBytes(c2.PubKey)) == -1
+}
+
+type earliestPolicy struct{}
+
+func (earliestPolicy) Eligible(state.SimpleDB, Params, *Candidate) bool { return true }
+
+// the pubkey is only compared between candidates declared in the same block
+func (earliestPolicy) Less(c1, c2 *Candidate) bool {
+	if c1.DeclareHeight != c2.DeclareHeight {
+		return c1.DeclareHeight < c2.DeclareHeight
+	}
+	return pubKeyPolicy{}.Less(c1, c2)
+}
+
+// hasMinSelfBond - whether the candidate's owner self-bonds at least the
+// Params.MinSelfBond, which a candidate needs to validate whatever the
+// policy. The owner can't unbond below it, but it may have been raised since
+// they bonded. A revoked candidate has no owner, so no self-bond.
+func hasMinSelfBond(store state.SimpleDB, params Params, candidate *Candidate) bool {
+	if params.MinSelfBond <= 0 {
+		return true
+	}
+	if candidate.Owner.Empty() {
+		return false
+	}
+	return candidate.CoinsFromShares(candidate.selfShares(store)) >= params.MinSelfBond
+}
@@ -0,0 +1,91 @@
+package stake
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cosmos/cosmos-sdk/state"
+)
+
+func TestSelectionPolicies(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+
+	// the candidates at index 0 and 1 tie, 0 has the larger pubkey but was
+	// declared earlier, 2 has more power but no self-bond
+	actors := newActors(3)
+	newStore := func(policy string, minSelfBond int64) state.SimpleDB {
+		store := state.NewMemKVStore()
+		params := loadParams(store)
+		params.MaxVals = 2
+		params.SelectionPolicy = policy
+		params.MinSelfBond = minSelfBond
+		saveParams(store, params)
+
+		for i, c := range []*Candidate{
+			{PubKey: pks[4], Owner: actors[0], Shares: 10, DeclareHeight: 1},
+			{PubKey: pks[3], Owner: actors[1], Shares: 10, DeclareHeight: 2},
+			{PubKey: pks[2], Owner: actors[2], Shares: 20, DeclareHeight: 3},
+		} {
+			saveCandidate(store, c)
+			if i < 2 {
+				saveDelegatorBond(store, c.Owner, &DelegatorBond{c.PubKey, 10})
+			}
+		}
+		return store
+	}
+	validators := func(store state.SimpleDB) (pubKeys []string) {
+		candidates, err := loadCandidates(store).updateVotingPower(store)
+		require.NoError(err)
+		for _, v := range candidates.Validators() {
+			pubKeys = append(pubKeys, v.PubKey.KeyString())
+		}
+		return
+	}
+
+	cases := []struct {
+		policy      string
+		minSelfBond int64
+		expected    []string
+	}{
+		{SelectionPubKey, 0, []string{pks[2].KeyString(), pks[3].KeyString()}},
+		{SelectionEarliest, 0, []string{pks[2].KeyString(), pks[4].KeyString()}},
+		// the min self-bond leaves 2 out under any policy
+		{SelectionPubKey, 10, []string{pks[3].KeyString(), pks[4].KeyString()}},
+		{SelectionEarliest, 10, []string{pks[4].KeyString(), pks[3].KeyString()}},
+		{SelectionEarliest, 11, nil},
+	}
+	for _, tc := range cases {
+		assert.Equal(tc.expected, validators(newStore(tc.policy, tc.minSelfBond)),
+			"%s with %d", tc.policy, tc.minSelfBond)
+	}
+
+	// an unknown policy is an error, and can't be set at genesis
+	store := newStore("unknown", 0)
+	_, err := loadCandidates(store).updateVotingPower(store)
+	assert.Error(err)
+	_, err = UpdateValidatorSet(store, 1)
+	assert.Error(err)
+
+	handler := NewHandler()
+	assert.Error(handler.initState(stakingModuleName, "selection_policy", "unknown", store))
+	require.NoError(handler.initState(stakingModuleName, "selection_policy", SelectionEarliest, store))
+	assert.Error(handler.initState(stakingModuleName, "min_self_bond", "-5", store))
+	assert.Error(handler.initState(stakingModuleName, "min_delegation", "-5", store))
+	require.NoError(handler.initState(stakingModuleName, "min_self_bond", "5", store))
+	params := loadParams(store)
+	assert.Equal(SelectionEarliest, params.SelectionPolicy)
+	assert.Equal(int64(5), params.MinSelfBond)
+}
+
+func TestDeclareHeight(t *testing.T) {
+	assert := assert.New(t)
+	senders, accStore := initAccounts(1, 1000)
+
+	deliverer := newDeliver(senders[0], accStore)
+	deliverer.height = 7
+	err := deliverer.declareCandidacy(newTxDeclareCandidacy(10, pks[0]))
+	assert.NoError(err)
+	assert.Equal(int64(7), loadCandidate(deliverer.store, pks[0]).DeclareHeight)
+}
@@ -0,0 +1,306 @@
+package stake
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	crypto "github.com/tendermint/go-crypto"
+
+	sdk "github.com/cosmos/cosmos-sdk"
+	"github.com/cosmos/cosmos-sdk/modules/auth"
+	"github.com/cosmos/cosmos-sdk/modules/coin"
+	"github.com/cosmos/cosmos-sdk/stack"
+	"github.com/cosmos/cosmos-sdk/state"
+)
+
+// run a single seed with: go test ./modules/stake -run TestSimulation -sim.seed N
+var (
+	simSeed = flag.Int64("sim.seed", 0, "Only run the stake simulation with this seed")
+	simRuns = flag.Int("sim.runs", 20, "Number of seeds the stake simulation runs")
+	simOps  = flag.Int("sim.ops", 300, "Number of random ops per stake simulation run")
+)
+
+const (
+	simAccounts   = 10
+	simBalance    = 1000
+	simCandidates = 8
+	simChainID    = "sim-chain"
+)
+
+var simPubKeys = func() (pubKeys []crypto.PubKey) {
+	for i := 0; i < simCandidates; i++ {
+		pubKeys = append(pubKeys, newPrivPubKey(fmt.Sprintf("simcandidate%d", i)))
+	}
+	return
+}()
+
+type simKind int
+
+const (
+	simDeclare simKind = iota
+	simEdit
+	simDelegate
+	simUnbond
+	simEndBlock
+)
+
+var simKindNames = []string{"declare", "edit", "delegate", "unbond", "end-block"}
+
+// simOp - one step of a simulation, accounts and candidates are indexes so
+// an op keeps its meaning when others are removed while shrinking
+type simOp struct {
+	Kind      simKind
+	Account   int
+	Candidate int
+	Amount    int64
+}
+
+func (op simOp) String() string {
+	if op.Kind == simEndBlock {
+		return simKindNames[op.Kind]
+	}
+	return fmt.Sprintf("%s account=%d candidate=%d amount=%d",
+		simKindNames[op.Kind], op.Account, op.Candidate, op.Amount)
+}
+
+// tx - the op's tx, sent by the sender
+func (op simOp) tx(sender sdk.Actor) sdk.Tx {
+	pk := simPubKeys[op.Candidate]
+	switch op.Kind {
+	case simDeclare:
+		tx := newTxDeclareCandidacy(op.Amount, pk)
+		tx.Description.Moniker = fmt.Sprintf("candidate%d", op.Candidate)
+		return signCandidacy(tx, simChainID, sender).Wrap()
+	case simEdit:
+		return NewTxEditCandidacy(pk, Description{Details: fmt.Sprintf("edit%d", op.Amount)})
+	case simDelegate:
+		return newTxDelegate(op.Amount, pk).Wrap()
+	}
+	return newTxUnbond(uint64(op.Amount), pk).Wrap()
+}
+
+// randomOps - a deterministic sequence of ops for the seed, with a block
+// ending every few ops
+func randomOps(seed int64, n int) (ops []simOp) {
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		op := simOp{
+			Kind:      simKind(r.Intn(int(simEndBlock) + 1)),
+			Account:   r.Intn(simAccounts),
+			Candidate: r.Intn(len(simPubKeys)),
+		}
+		switch op.Kind {
+		case simDeclare, simDelegate:
+			op.Amount = 1 + r.Int63n(simBalance/4)
+		case simUnbond:
+			op.Amount = 1 + r.Int63n(simBalance/2)
+		case simEdit:
+			op.Amount = r.Int63n(100)
+		}
+		if op.Kind != simEndBlock && r.Intn(10) == 0 {
+			ops = append(ops, simOp{Kind: simEndBlock})
+		}
+		ops = append(ops, op)
+	}
+	return
+}
+
+// simulate runs the ops against a fresh in-memory app store with the
+// Params.MaxPowerFraction, with each tx going through CheckTx and DeliverTx
+// on a checkpoint, like the app's stack. After each block the invariants must
+// hold and the validator updates sent to Tendermint must add up to the stored
+// validator set.
+func simulate(ops []simOp, fraction uint64) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	store := state.NewMemKVStore()
+	params := loadParams(stack.PrefixedStore(Name(), store))
+	params.MaxPowerFraction = fraction
+	saveParams(stack.PrefixedStore(Name(), store), params)
+	handler := NewHandler()
+	senders := make([]sdk.Actor, simAccounts)
+	for i := range senders {
+		senders[i] = auth.SigPerm([]byte(fmt.Sprintf("simaccount%d", i)))
+		_, err = coin.ChangeCoins(stack.PrefixedStore(coin.NameCoin, store), senders[i],
+			coin.Coins{{"fermion", simBalance}})
+		if err != nil {
+			return err
+		}
+	}
+
+	height := int64(1)
+	validators := make(map[string]int64) // as known by Tendermint
+	endBlock := func() error {
+		stakeStore := stack.PrefixedStore(Name(), store)
+		change, err := UpdateValidatorSet(stakeStore, height)
+		if err != nil {
+			return fmt.Errorf("height %d: %v", height, err)
+		}
+		PruneValidatorHistory(stakeStore, height)
+
+		if violations := Invariants(store); len(violations) > 0 {
+			return fmt.Errorf("height %d: %s", height, strings.Join(violations, "; "))
+		}
+
+		// the changes can't move more power than the churn limit allows
+		var total, moved int64
+		for _, power := range validators {
+			total += power
+		}
+		for _, c := range change {
+			diff := c.Power - validators[string(c.PubKey)]
+			if diff < 0 {
+				diff = -diff
+			}
+			moved += diff
+		}
+		churn := int64(loadParams(stakeStore).MaxPowerChurn)
+		limit := total * churn / maxRatio
+		if limit == 0 {
+			limit = 1
+		}
+		if churn > 0 && total > 0 && moved > limit {
+			return fmt.Errorf("height %d: the changes move %d of %d power, more than %d",
+				height, moved, total, limit)
+		}
+
+		for _, c := range change {
+			if c.Power == 0 {
+				delete(validators, string(c.PubKey))
+			} else {
+				validators[string(c.PubKey)] = c.Power
+			}
+		}
+		set := loadValidatorSet(stakeStore, height+1)
+		if len(set) != len(validators) {
+			return fmt.Errorf("height %d: %d validators stored, %d sent to Tendermint",
+				height, len(set), len(validators))
+		}
+		for _, v := range set {
+			if validators[string(v.PubKey.Bytes())] != int64(v.Power) {
+				return fmt.Errorf("height %d: validator %s has power %d, Tendermint has %d",
+					height, v.PubKey.KeyString(), v.Power, validators[string(v.PubKey.Bytes())])
+			}
+		}
+		height++
+		return nil
+	}
+
+	for _, op := range ops {
+		if op.Kind == simEndBlock {
+			if err = endBlock(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// invalid ops are expected, they must just leave no trace
+		ctx := stack.MockContext(simChainID, height).WithPermissions(senders[op.Account])
+		cache := store.Checkpoint()
+		stakeStore := stack.PrefixedStore(Name(), cache)
+		coinStore := stack.PrefixedStore(coin.NameCoin, cache)
+		dispatch := sdk.DeliverFunc(func(ctx sdk.Context, _ state.SimpleDB,
+			tx sdk.Tx) (res sdk.DeliverResult, err error) {
+			return testCoinDispatch.DeliverTx(ctx, coinStore, tx)
+		})
+
+		tx := op.tx(senders[op.Account])
+		if _, err := handler.CheckTx(ctx, stakeStore, tx, nil); err != nil {
+			cache.Discard()
+			continue
+		}
+		if _, err := handler.DeliverTx(ctx, stakeStore, tx, dispatch); err != nil {
+			cache.Discard()
+			continue
+		}
+		if err = store.Commit(cache); err != nil {
+			return err
+		}
+	}
+	return endBlock()
+}
+
+// shrinkOps removes ever smaller chunks of ops for as long as the sequence
+// keeps failing, leaving a sequence where no single op can be removed
+func shrinkOps(ops []simOp, fails func([]simOp) bool) []simOp {
+	for chunk := len(ops) / 2; chunk > 0; {
+		removed := false
+		for i := 0; i+chunk <= len(ops); {
+			try := append(append([]simOp{}, ops[:i]...), ops[i+chunk:]...)
+			if fails(try) {
+				ops, removed = try, true
+				continue
+			}
+			i += chunk
+		}
+		if !removed {
+			chunk /= 2
+		} else if chunk > len(ops)/2 {
+			chunk = len(ops) / 2
+		}
+	}
+	return ops
+}
+
+func TestSimulation(t *testing.T) {
+	seeds := []int64{*simSeed}
+	if *simSeed == 0 {
+		runs := *simRuns
+		if testing.Short() {
+			runs = 3
+		}
+		seeds = nil
+		for i := 1; i <= runs; i++ {
+			seeds = append(seeds, int64(i))
+		}
+	}
+
+	// without and with a power cap, which the churn limit must hold to too
+	for _, fraction := range []uint64{0, 3333} {
+		for _, seed := range seeds {
+			ops := randomOps(seed, *simOps)
+			err := simulate(ops, fraction)
+			if err == nil {
+				continue
+			}
+
+			fails := func(ops []simOp) bool { return simulate(ops, fraction) != nil }
+			ops = shrinkOps(ops, fails)
+			var buf bytes.Buffer
+			for _, op := range ops {
+				fmt.Fprintf(&buf, "  %v\n", op)
+			}
+			t.Fatalf("seed %d, max power fraction %d: %v\nshrunk to %d ops, failing with %v:\n%s",
+				seed, fraction, err, len(ops), simulate(ops, fraction), buf.String())
+		}
+	}
+}
+
+func TestShrinkOps(t *testing.T) {
+	ops := randomOps(7, 200)
+	target := []simOp{ops[42], ops[150]}
+
+	// fails while both target ops are still in order in the sequence
+	fails := func(ops []simOp) bool {
+		found := 0
+		for _, op := range ops {
+			if found < len(target) && op == target[found] {
+				found++
+			}
+		}
+		return found == len(target)
+	}
+
+	shrunk := shrinkOps(ops, fails)
+	if !fails(shrunk) || len(shrunk) != len(target) {
+		t.Fatalf("expected to shrink to %v, got %v", target, shrunk)
+	}
+}
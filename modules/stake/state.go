@@ -1,6 +1,9 @@
 package stake
 
 import (
+	"bytes"
+	"encoding/binary"
+
 	crypto "github.com/tendermint/go-crypto"
 	"github.com/tendermint/go-wire"
 
@@ -13,11 +16,19 @@ var (
 	// Keys for store prefixes
 	CandidatesPubKeysKey = []byte{0x01} // key for all candidates' pubkeys
 	ParamKey             = []byte{0x02} // key for global parameters relating to staking
+	KeyRotationsKey      = []byte{0x0d} // key for the consensus key rotations since the last update
 
 	// Key prefixes
-	CandidateKeyPrefix      = []byte{0x03} // prefix for each key to a candidate
-	DelegatorBondKeyPrefix  = []byte{0x04} // prefix for each key to a delegator's bond
-	DelegatorBondsKeyPrefix = []byte{0x05} // prefix for each key to a delegator's bond
+	CandidateKeyPrefix           = []byte{0x03} // prefix for each key to a candidate
+	DelegatorBondKeyPrefix       = []byte{0x04} // prefix for each key to a delegator's bond
+	DelegatorBondsKeyPrefix      = []byte{0x05} // prefix for each key to a delegator's bond
+	ValidatorChangesPrefix       = []byte{0x06} // prefix for the validator changes at each height
+	ValidatorSetPrefix           = []byte{0x07} // prefix for the validator set at each height
+	CandidateDelegatorsKeyPrefix = []byte{0x08} // prefix for each key to a candidate's delegator
+	LiquidPoolKeyPrefix          = []byte{0x09} // prefix for the liquid pool of each candidate
+	DeferredChangesPrefix        = []byte{0x0a} // prefix for the validator changes deferred at each height
+	DelegatorsIndexKeyPrefix     = []byte{0x0b} // prefix for the numbered delegators of each candidate
+	PoolChangesPrefix            = []byte{0x0e} // prefix for the liquid pool changes at each height
 )
 
 // GetCandidateKey - get the key for the candidate with pubKey
@@ -40,6 +51,70 @@ func GetDelegatorBondsKey(delegator sdk.Actor) []byte {
 	return append(DelegatorBondsKeyPrefix, wire.BinaryBytes(&delegator)...)
 }
 
+// GetCandidateDelegatorsKey - get the prefix for the indexes of all the
+// delegators bonded to a candidate
+func GetCandidateDelegatorsKey(candidate crypto.PubKey) []byte {
+	return append(CandidateDelegatorsKeyPrefix, candidate.Bytes()...)
+}
+
+// GetCandidateDelegatorKey - get the key for the index of a delegator bonded
+// to a candidate
+func GetCandidateDelegatorKey(candidate crypto.PubKey, delegator sdk.Actor) []byte {
+	return append(GetCandidateDelegatorsKey(candidate), wire.BinaryBytes(&delegator)...)
+}
+
+// GetDelegatorsCountKey - get the key for the number of delegators bonded to
+// a candidate
+func GetDelegatorsCountKey(candidate crypto.PubKey) []byte {
+	return append(DelegatorsIndexKeyPrefix, candidate.Bytes()...)
+}
+
+// GetDelegatorAtKey - get the key for the delegator bonded to a candidate at
+// an index, from 0 to the count
+func GetDelegatorAtKey(candidate crypto.PubKey, index int64) []byte {
+	return append(GetDelegatorsCountKey(candidate), heightBytes(index)...)
+}
+
+// GetLiquidPoolKey - get the key for the liquid pool of a candidate
+func GetLiquidPoolKey(candidate crypto.PubKey) []byte {
+	return append(LiquidPoolKeyPrefix, candidate.Bytes()...)
+}
+
+// GetValidatorChangesKey - get the key for the validator changes at a height
+func GetValidatorChangesKey(height int64) []byte {
+	return append(ValidatorChangesPrefix, heightBytes(height)...)
+}
+
+// GetDeferredChangesKey - get the key for the validator changes deferred at
+// a height
+func GetDeferredChangesKey(height int64) []byte {
+	return append(DeferredChangesPrefix, heightBytes(height)...)
+}
+
+// GetPoolChangesKey - get the key for the liquid pool changes at a height
+func GetPoolChangesKey(height int64) []byte {
+	return append(PoolChangesPrefix, heightBytes(height)...)
+}
+
+// GetValidatorSetKey - get the key for the validator set of a height
+func GetValidatorSetKey(height int64) []byte {
+	return append(ValidatorSetPrefix, heightBytes(height)...)
+}
+
+// prefixEnd - the end of a List over all the keys starting with prefix
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	end[len(end)-1]++
+	return end
+}
+
+// big endian so the keys sort by height, or by index
+func heightBytes(height int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(height))
+	return b
+}
+
 //---------------------------------------------------------------------
 
 // Get the active list of all the candidate pubKeys and owners
@@ -131,8 +206,106 @@ func loadDelegatorCandidates(store state.SimpleDB,
 	return
 }
 
+// The delegators bonded to a candidate are numbered from 0 to their count, so
+// that a client can prove a page of them one key at a time, and each
+// delegator's number is kept to remove it in place of the last one.
+
+// load the delegators bonded to a candidate, in the order of their index
+func loadCandidateDelegators(store state.SimpleDB,
+	candidate crypto.PubKey) (delegators []sdk.Actor) {
+
+	// the keys are long enough for the List of a prefixed store
+	start := GetDelegatorAtKey(candidate, 0)
+	end := prefixEnd(GetDelegatorsCountKey(candidate))
+	for _, m := range store.List(start, end, 0) {
+		var delegator sdk.Actor
+		if err := wire.ReadBinaryBytes(m.Value, &delegator); err != nil {
+			panic(err)
+		}
+		delegators = append(delegators, delegator)
+	}
+	return
+}
+
+// loadDelegatorsCount - the number of delegators bonded to a candidate
+func loadDelegatorsCount(store state.SimpleDB, candidate crypto.PubKey) (count int64) {
+	b := store.Get(GetDelegatorsCountKey(candidate))
+	if b == nil {
+		return 0
+	}
+	if err := wire.ReadBinaryBytes(b, &count); err != nil {
+		panic(err)
+	}
+	return
+}
+
+func addCandidateDelegator(store state.SimpleDB,
+	candidate crypto.PubKey, delegator sdk.Actor) {
+
+	index := loadDelegatorsCount(store, candidate)
+	store.Set(GetDelegatorAtKey(candidate, index), wire.BinaryBytes(delegator))
+	store.Set(GetCandidateDelegatorKey(candidate, delegator), wire.BinaryBytes(index))
+	store.Set(GetDelegatorsCountKey(candidate), wire.BinaryBytes(index+1))
+}
+
+func removeCandidateDelegator(store state.SimpleDB,
+	candidate crypto.PubKey, delegator sdk.Actor) {
+
+	key := GetCandidateDelegatorKey(candidate, delegator)
+	b := store.Get(key)
+	if b == nil {
+		return
+	}
+	var index int64
+	if err := wire.ReadBinaryBytes(b, &index); err != nil {
+		panic(err)
+	}
+	store.Remove(key)
+
+	// the last delegator takes the removed one's index
+	last := loadDelegatorsCount(store, candidate) - 1
+	if index != last {
+		lastBytes := store.Get(GetDelegatorAtKey(candidate, last))
+		var moved sdk.Actor
+		if err := wire.ReadBinaryBytes(lastBytes, &moved); err != nil {
+			panic(err)
+		}
+		store.Set(GetDelegatorAtKey(candidate, index), lastBytes)
+		store.Set(GetCandidateDelegatorKey(candidate, moved), wire.BinaryBytes(index))
+	}
+	store.Remove(GetDelegatorAtKey(candidate, last))
+	if last == 0 {
+		store.Remove(GetDelegatorsCountKey(candidate))
+		return
+	}
+	store.Set(GetDelegatorsCountKey(candidate), wire.BinaryBytes(last))
+}
+
 //---------------------------------------------------------------------
 
+func loadLiquidPool(store state.SimpleDB, candidate crypto.PubKey) *LiquidPool {
+	b := store.Get(GetLiquidPoolKey(candidate))
+	if b == nil {
+		return nil
+	}
+	pool := new(LiquidPool)
+	err := wire.ReadBinaryBytes(b, pool)
+	if err != nil {
+		panic(err)
+	}
+	return pool
+}
+
+// saveLiquidPool - save the pool, or remove it once nothing is left in it
+func saveLiquidPool(store state.SimpleDB, pool *LiquidPool) {
+	if len(pool.Entries) == 0 {
+		store.Remove(GetLiquidPoolKey(pool.PubKey))
+		return
+	}
+	b := wire.BinaryBytes(*pool)
+	store.Set(GetLiquidPoolKey(pool.PubKey), b)
+}
+
 func loadDelegatorBond(store state.SimpleDB,
 	delegator sdk.Actor, candidate crypto.PubKey) *DelegatorBond {
 
@@ -157,6 +330,9 @@ func saveDelegatorBond(store state.SimpleDB, delegator sdk.Actor, bond *Delegato
 		pks = append(pks, (*bond).PubKey)
 		b := wire.BinaryBytes(pks)
 		store.Set(GetDelegatorBondsKey(delegator), b)
+
+		// and to the candidate's delegators
+		addCandidateDelegator(store, bond.PubKey, delegator)
 	}
 
 	// now actually save the bond
@@ -173,10 +349,18 @@ func removeDelegatorBond(store state.SimpleDB, delegator sdk.Actor, candidate cr
 	for i, pk := range pks {
 		if candidate.Equals(pk) {
 			pks = append(pks[:i], pks[i+1:]...)
+			break
 		}
 	}
-	b := wire.BinaryBytes(pks)
-	store.Set(GetDelegatorBondsKey(delegator), b)
+	if len(pks) == 0 {
+		store.Remove(GetDelegatorBondsKey(delegator))
+	} else {
+		b := wire.BinaryBytes(pks)
+		store.Set(GetDelegatorBondsKey(delegator), b)
+	}
+
+	// and from the candidate's delegators
+	removeCandidateDelegator(store, candidate, delegator)
 
 	// now remove the actual bond
 	store.Remove(GetDelegatorBondKey(delegator, candidate))
@@ -218,6 +402,165 @@ func removeDelegatorBond(store state.SimpleDB, delegator sdk.Actor, candidate cr
 
 //---------------------------------------------------------------------
 
+// load/save the consensus key rotations since the validator set was last
+// updated
+func loadKeyRotations(store state.SimpleDB) (rotations []keyRotation) {
+	b := store.Get(KeyRotationsKey)
+	if b == nil {
+		return
+	}
+	err := wire.ReadBinaryBytes(b, &rotations)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+func saveKeyRotations(store state.SimpleDB, rotations []keyRotation) {
+	if len(rotations) == 0 {
+		store.Remove(KeyRotationsKey)
+		return
+	}
+	b := wire.BinaryBytes(rotations)
+	store.Set(KeyRotationsKey, b)
+}
+
+// addKeyRotation - record the rotation from the old to the new consensus key,
+// a key rotated again before the update is recorded from the first key
+func addKeyRotation(store state.SimpleDB, oldKey, newKey crypto.PubKey) {
+	rotations := loadKeyRotations(store)
+	for i, r := range rotations {
+		if r.New.Equals(oldKey) {
+			rotations[i].New = newKey
+			saveKeyRotations(store, rotations)
+			return
+		}
+	}
+	saveKeyRotations(store, append(rotations, keyRotation{oldKey, newKey}))
+}
+
+//---------------------------------------------------------------------
+
+// load/save the validator changes reported to Tendermint at a height
+func loadValidatorChanges(store state.SimpleDB, height int64) (changes []ValidatorChange) {
+	b := store.Get(GetValidatorChangesKey(height))
+	if b == nil {
+		return
+	}
+	err := wire.ReadBinaryBytes(b, &changes)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+func saveValidatorChanges(store state.SimpleDB, height int64, changes []ValidatorChange) {
+	b := wire.BinaryBytes(changes)
+	store.Set(GetValidatorChangesKey(height), b)
+}
+
+// load/save the validator changes deferred by the churn limit at a height,
+// nothing is saved for a height without any
+func loadDeferredChanges(store state.SimpleDB, height int64) (changes []ValidatorChange) {
+	b := store.Get(GetDeferredChangesKey(height))
+	if b == nil {
+		return
+	}
+	err := wire.ReadBinaryBytes(b, &changes)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+func saveDeferredChanges(store state.SimpleDB, height int64, changes []ValidatorChange) {
+	if len(changes) == 0 {
+		return
+	}
+	b := wire.BinaryBytes(changes)
+	store.Set(GetDeferredChangesKey(height), b)
+}
+
+// load/save the bonds moved into or out of the liquid pools at a height,
+// nothing is saved for a height without any
+func loadPoolChanges(store state.SimpleDB, height int64) (changes []PoolChange) {
+	b := store.Get(GetPoolChangesKey(height))
+	if b == nil {
+		return
+	}
+	err := wire.ReadBinaryBytes(b, &changes)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+func savePoolChanges(store state.SimpleDB, height int64, changes []PoolChange) {
+	if len(changes) == 0 {
+		return
+	}
+	b := wire.BinaryBytes(changes)
+	store.Set(GetPoolChangesKey(height), b)
+}
+
+// load/save the validator set which validates the block at a height
+func loadValidatorSet(store state.SimpleDB, height int64) (validators []ValidatorPower) {
+	_, validators = loadValidatorSetInfo(store, height)
+	return
+}
+func saveValidatorSet(store state.SimpleDB, height int64, validators []ValidatorPower) {
+	info := ValidatorSetInfo{height, validators}
+
+	// only point back to the last set stored if nothing changed
+	changed, last := loadValidatorSetInfo(store, height-1)
+	if changed != 0 && bytes.Equal(wire.BinaryBytes(last), wire.BinaryBytes(validators)) {
+		info = ValidatorSetInfo{ChangedHeight: changed}
+	}
+	b := wire.BinaryBytes(info)
+	store.Set(GetValidatorSetKey(height), b)
+}
+
+// loadValidatorSetInfo - the validator set of a height, following the pointer
+// back to the height it was stored at, and that height
+func loadValidatorSetInfo(store state.SimpleDB, height int64) (changed int64, validators []ValidatorPower) {
+	var info ValidatorSetInfo
+	for {
+		b := store.Get(GetValidatorSetKey(height))
+		if b == nil {
+			return 0, nil
+		}
+		err := wire.ReadBinaryBytes(b, &info)
+		if err != nil {
+			panic(err)
+		}
+		if info.ChangedHeight == height {
+			return height, info.Validators
+		}
+		height = info.ChangedHeight
+	}
+}
+
+// PruneValidatorHistory - remove the validator sets, changes, deferred
+// changes and pool changes of the heights before the last
+// Params.ValidatorHistory blocks, a history of 0 keeps them all. The
+// validator set the oldest height kept points back to is kept too.
+func PruneValidatorHistory(store state.SimpleDB, height int64) {
+	keep := loadParams(store).ValidatorHistory
+	if keep <= 0 || height <= keep {
+		return
+	}
+	cutoff := height - keep + 1
+	changed, _ := loadValidatorSetInfo(store, cutoff)
+	for _, prefix := range [][]byte{ValidatorSetPrefix, ValidatorChangesPrefix,
+		DeferredChangesPrefix, PoolChangesPrefix} {
+		end := append(append([]byte{}, prefix...), heightBytes(cutoff)...)
+		for _, m := range store.List(prefix, end, 0) {
+			if bytes.Equal(m.Key, GetValidatorSetKey(changed)) {
+				continue
+			}
+			store.Remove(m.Key)
+		}
+	}
+}
+
+//---------------------------------------------------------------------
+
 // load/save the global staking params
 func loadParams(store state.SimpleDB) (params Params) {
 	b := store.Get(ParamKey)
@@ -6,6 +6,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/tendermint/go-wire"
+
 	"github.com/cosmos/cosmos-sdk"
 	"github.com/cosmos/cosmos-sdk/state"
 )
@@ -75,6 +77,28 @@ func TestState(t *testing.T) {
 	resBond = loadDelegatorBond(store, delegator, pk)
 	assert.Equal(bond, resBond)
 
+	// the delegator is listed once with the candidate
+	assert.Equal([]sdk.Actor{delegator}, loadCandidateDelegators(store, pk))
+
+	// more delegators are appended, removing a bond moves the last delegator
+	// into its index
+	delegator2 := sdk.Actor{"testChain", "testapp", []byte("addressdelegato2")}
+	delegator3 := sdk.Actor{"testChain", "testapp", []byte("addressdelegato3")}
+	saveDelegatorBond(store, delegator2, bond)
+	saveDelegatorBond(store, delegator3, bond)
+	assert.Equal([]sdk.Actor{delegator, delegator2, delegator3}, loadCandidateDelegators(store, pk))
+	assert.EqualValues(3, loadDelegatorsCount(store, pk))
+	removeDelegatorBond(store, delegator, pk)
+	assert.Equal([]sdk.Actor{delegator3, delegator2}, loadCandidateDelegators(store, pk))
+	removeDelegatorBond(store, delegator2, pk)
+	assert.Equal([]sdk.Actor{delegator3}, loadCandidateDelegators(store, pk))
+	removeDelegatorBond(store, delegator3, pk)
+	assert.Nil(loadCandidateDelegators(store, pk))
+	assert.EqualValues(0, loadDelegatorsCount(store, pk))
+	assert.False(store.Has(GetDelegatorsCountKey(pk)))
+	assert.False(store.Has(GetDelegatorAtKey(pk, 0)))
+	assert.False(store.Has(GetCandidateDelegatorKey(pk, delegator3)))
+
 	//----------------------------------------------------------------------
 	// Param checks
 
@@ -90,3 +114,65 @@ func TestState(t *testing.T) {
 	resParams = loadParams(store)
 	assert.Equal(params, resParams)
 }
+
+func TestValidatorHistory(t *testing.T) {
+	assert := assert.New(t)
+	store := state.NewMemKVStore()
+
+	params := loadParams(store)
+	params.ValidatorHistory = 3
+	saveParams(store, params)
+
+	delegator := sdk.Actor{"testChain", "testapp", []byte("addressdelegator")}
+	sets := make(map[int64][]ValidatorPower)
+	for h := int64(1); h <= 6; h++ {
+		sets[h] = []ValidatorPower{{pks[0], uint64(h)}}
+		saveValidatorSet(store, h, sets[h])
+		saveValidatorChanges(store, h, []ValidatorChange{{pks[0], uint64(h - 1), uint64(h)}})
+		savePoolChanges(store, h, []PoolChange{{pks[0], delegator, ActionPool, h}})
+	}
+
+	// nothing is pruned until the window is full
+	PruneValidatorHistory(store, 3)
+	assert.Equal(sets[1], loadValidatorSet(store, 1))
+
+	// only the last 3 heights, 4 to 6, are kept
+	PruneValidatorHistory(store, 6)
+	for h := int64(1); h <= 6; h++ {
+		if h < 4 {
+			assert.Nil(loadValidatorSet(store, h), "%d", h)
+			assert.Nil(loadValidatorChanges(store, h), "%d", h)
+			assert.Nil(loadPoolChanges(store, h), "%d", h)
+		} else {
+			assert.Equal(sets[h], loadValidatorSet(store, h), "%d", h)
+			assert.NotNil(loadValidatorChanges(store, h), "%d", h)
+			assert.NotNil(loadPoolChanges(store, h), "%d", h)
+		}
+	}
+
+	// an unchanged set only points back to the height it was stored at
+	for h := int64(7); h <= 9; h++ {
+		saveValidatorSet(store, h, sets[6])
+		changed, set := loadValidatorSetInfo(store, h)
+		assert.Equal(int64(6), changed, "%d", h)
+		assert.Equal(sets[6], set, "%d", h)
+	}
+	var info ValidatorSetInfo
+	require.NoError(t, wire.ReadBinaryBytes(store.Get(GetValidatorSetKey(8)), &info))
+	assert.Equal(int64(6), info.ChangedHeight)
+	assert.Empty(info.Validators)
+
+	// which is kept while a height kept points to it
+	PruneValidatorHistory(store, 9)
+	assert.Nil(loadValidatorSet(store, 5))
+	for h := int64(6); h <= 9; h++ {
+		assert.Equal(sets[6], loadValidatorSet(store, h), "%d", h)
+	}
+
+	// 0 keeps everything, a negative history can't be set
+	handler := NewHandler()
+	assert.Error(handler.initState(stakingModuleName, "validator_history", "-1", store))
+	require.NoError(t, handler.initState(stakingModuleName, "validator_history", "0", store))
+	PruneValidatorHistory(store, 100)
+	assert.Equal(sets[6], loadValidatorSet(store, 6))
+}
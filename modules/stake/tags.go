@@ -0,0 +1,126 @@
+package stake
+
+import (
+	abci "github.com/tendermint/abci/types"
+	crypto "github.com/tendermint/go-crypto"
+
+	sdk "github.com/cosmos/cosmos-sdk"
+	"github.com/cosmos/cosmos-sdk/modules/coin"
+)
+
+// Tags attached to the DeliverResult of every stake tx, so the txs can be
+// found with the node's tx search. The node only indexes the tags listed in
+// the index_tags of its config.toml [tx_index] section.
+const (
+	TagAction    = "stake.action"
+	TagDelegator = "stake.delegator"
+	TagCandidate = "stake.candidate"
+	TagAmount    = "stake.amount"
+	TagShares    = "stake.shares"
+
+	TagNewCandidate = "stake.new_candidate" // the new pubkey of a rotated candidate
+	TagNewOwner     = "stake.new_owner"     // the new owner of a transferred candidate
+)
+
+// Values of the stake.action tag
+const (
+	ActionDeclareCandidacy = "declare-candidacy"
+	ActionEditCandidacy    = "edit-candidacy"
+	ActionDelegate         = "delegate"
+	ActionUnbond           = "unbond"
+
+	ActionRotateConsensusKey = "rotate-consensus-key"
+	ActionTransferOwnership  = "transfer-ownership"
+	ActionRevokeCandidacy    = "revoke-candidacy"
+	ActionWithdrawPool       = "withdraw-pool"
+)
+
+// Actions of the liquid pool changes made by a validator set update, which
+// are recorded for the height rather than tagged
+const (
+	ActionPool   = "pool"   // a bond moved into the pool of a kicked candidate
+	ActionRebond = "rebond" // a pool entry bonded back to its candidate
+)
+
+// txTags collects the tags for each action of a tx, a nil *txTags ignores them
+type txTags struct {
+	pairs []*abci.KVPair
+}
+
+// add the tags for one action, an empty amount or zero shares are left out
+func (t *txTags) add(action string, delegator sdk.Actor, candidate crypto.PubKey,
+	amount coin.Coin, shares uint64) {
+
+	if t == nil {
+		return
+	}
+	t.pairs = append(t.pairs,
+		abci.KVPairString(TagAction, action),
+		abci.KVPairString(TagDelegator, delegator.String()),
+		abci.KVPairString(TagCandidate, candidate.KeyString()),
+	)
+	if !amount.IsZero() {
+		t.pairs = append(t.pairs, abci.KVPairString(TagAmount, amount.String()))
+	}
+	if shares != 0 {
+		t.pairs = append(t.pairs, abci.KVPairInt(TagShares, int64(shares)))
+	}
+}
+
+// addNewCandidate - add the new pubkey to the last action
+func (t *txTags) addNewCandidate(candidate crypto.PubKey) {
+	if t == nil {
+		return
+	}
+	t.pairs = append(t.pairs, abci.KVPairString(TagNewCandidate, candidate.KeyString()))
+}
+
+// addNewOwner - add the new owner to the last action
+func (t *txTags) addNewOwner(owner sdk.Actor) {
+	if t == nil {
+		return
+	}
+	t.pairs = append(t.pairs, abci.KVPairString(TagNewOwner, owner.String()))
+}
+
+// TxEvent - one stake action of a tx, as read back from the tx's tags
+type TxEvent struct {
+	Action    string `json:"action"`
+	Delegator string `json:"delegator"`
+	Candidate string `json:"candidate"`
+	Amount    string `json:"amount,omitempty"`
+	Shares    uint64 `json:"shares,omitempty"`
+
+	NewCandidate string `json:"new_candidate,omitempty"`
+	NewOwner     string `json:"new_owner,omitempty"`
+}
+
+// TxEvents - read the stake actions back from the tags of a DeliverTx
+// result, tags of other modules are ignored
+func TxEvents(tags []*abci.KVPair) (events []TxEvent) {
+	for _, tag := range tags {
+		if tag.Key == TagAction {
+			events = append(events, TxEvent{Action: tag.ValueString})
+			continue
+		}
+		if len(events) == 0 {
+			continue
+		}
+		e := &events[len(events)-1]
+		switch tag.Key {
+		case TagDelegator:
+			e.Delegator = tag.ValueString
+		case TagCandidate:
+			e.Candidate = tag.ValueString
+		case TagAmount:
+			e.Amount = tag.ValueString
+		case TagShares:
+			e.Shares = uint64(tag.ValueInt)
+		case TagNewCandidate:
+			e.NewCandidate = tag.ValueString
+		case TagNewOwner:
+			e.NewOwner = tag.ValueString
+		}
+	}
+	return
+}
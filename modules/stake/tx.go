@@ -6,6 +6,7 @@ import (
 	sdk "github.com/cosmos/cosmos-sdk"
 	"github.com/cosmos/cosmos-sdk/modules/coin"
 	crypto "github.com/tendermint/go-crypto"
+	"github.com/tendermint/go-wire"
 )
 
 // Tx
@@ -19,10 +20,22 @@ const (
 	ByteTxEditCandidacy    = 0x56
 	ByteTxDelegate         = 0x57
 	ByteTxUnbond           = 0x58
+	ByteTxStakeBatch       = 0x59
+	ByteTxRotateKey        = 0x5a
+	ByteTxTransferOwner    = 0x5b
+	ByteTxActAs            = 0x5c
+	ByteTxRevokeCandidacy  = 0x5d
+	ByteTxWithdrawPool     = 0x5e
 	TypeTxDeclareCandidacy = stakingModuleName + "/declareCandidacy"
 	TypeTxEditCandidacy    = stakingModuleName + "/editCandidacy"
 	TypeTxDelegate         = stakingModuleName + "/delegate"
 	TypeTxUnbond           = stakingModuleName + "/unbond"
+	TypeTxStakeBatch       = stakingModuleName + "/batch"
+	TypeTxRotateKey        = stakingModuleName + "/rotateConsensusKey"
+	TypeTxTransferOwner    = stakingModuleName + "/transferOwnership"
+	TypeTxActAs            = stakingModuleName + "/actAs"
+	TypeTxRevokeCandidacy  = stakingModuleName + "/revokeCandidacy"
+	TypeTxWithdrawPool     = stakingModuleName + "/withdrawPool"
 )
 
 func init() {
@@ -30,10 +43,37 @@ func init() {
 	sdk.TxMapper.RegisterImplementation(TxEditCandidacy{}, TypeTxEditCandidacy, ByteTxEditCandidacy)
 	sdk.TxMapper.RegisterImplementation(TxDelegate{}, TypeTxDelegate, ByteTxDelegate)
 	sdk.TxMapper.RegisterImplementation(TxUnbond{}, TypeTxUnbond, ByteTxUnbond)
+	sdk.TxMapper.RegisterImplementation(TxStakeBatch{}, TypeTxStakeBatch, ByteTxStakeBatch)
+	sdk.TxMapper.RegisterImplementation(TxRotateConsensusKey{}, TypeTxRotateKey, ByteTxRotateKey)
+	sdk.TxMapper.RegisterImplementation(TxTransferOwnership{}, TypeTxTransferOwner, ByteTxTransferOwner)
+	sdk.TxMapper.RegisterImplementation(TxActAs{}, TypeTxActAs, ByteTxActAs)
+	sdk.TxMapper.RegisterImplementation(TxRevokeCandidacy{}, TypeTxRevokeCandidacy, ByteTxRevokeCandidacy)
+	sdk.TxMapper.RegisterImplementation(TxWithdrawPool{}, TypeTxWithdrawPool, ByteTxWithdrawPool)
 }
 
 //Verify interface at compile time
-var _, _, _, _ sdk.TxInner = &TxDeclareCandidacy{}, &TxEditCandidacy{}, &TxDelegate{}, &TxUnbond{}
+var _, _, _, _, _, _, _, _, _, _ sdk.TxInner = &TxDeclareCandidacy{}, &TxEditCandidacy{}, &TxDelegate{}, &TxUnbond{},
+	&TxStakeBatch{}, &TxRotateConsensusKey{}, &TxTransferOwnership{}, &TxActAs{}, &TxRevokeCandidacy{},
+	&TxWithdrawPool{}
+
+// consensusPubKeyTypes - the pubkey types tendermint can decode from a
+// validator update, any other key type would halt the chain once it is
+// elected as a validator
+var consensusPubKeyTypes = map[byte]bool{
+	crypto.TypeEd25519:   true,
+	crypto.TypeSecp256k1: true,
+}
+
+// validatePubKey - check for a non-empty candidate pubkey of a usable type
+func validatePubKey(pk crypto.PubKey) error {
+	if pk.Empty() {
+		return errCandidateEmpty
+	}
+	if !consensusPubKeyTypes[pk.Bytes()[0]] {
+		return ErrBadPubKeyType()
+	}
+	return nil
+}
 
 // BondUpdate - struct for bonding or unbonding transactions
 type BondUpdate struct {
@@ -43,8 +83,8 @@ type BondUpdate struct {
 
 // ValidateBasic - Check for non-empty candidate, and valid coins
 func (tx BondUpdate) ValidateBasic() error {
-	if tx.PubKey.Empty() {
-		return errCandidateEmpty
+	if err := validatePubKey(tx.PubKey); err != nil {
+		return err
 	}
 
 	coins := coin.Coins{tx.Bond}
@@ -57,30 +97,68 @@ func (tx BondUpdate) ValidateBasic() error {
 	return nil
 }
 
-// TxDeclareCandidacy - struct for unbonding transactions
+// TxDeclareCandidacy - struct for unbonding transactions. PubKeySig proves
+// the owner holds the consensus private key, it signs the
+// CandidacySignBytes of the chain and the owner.
 type TxDeclareCandidacy struct {
 	BondUpdate
 	Description
+	Threshold SafetyThreshold  `json:"safety_threshold"`
+	PubKeySig crypto.Signature `json:"pub_key_sig"`
 }
 
 // NewTxDeclareCandidacy - new TxDeclareCandidacy
-func NewTxDeclareCandidacy(bond coin.Coin, pubKey crypto.PubKey, description Description) sdk.Tx {
+func NewTxDeclareCandidacy(bond coin.Coin, pubKey crypto.PubKey, description Description,
+	threshold SafetyThreshold, pubKeySig crypto.Signature) sdk.Tx {
+
 	return TxDeclareCandidacy{
 		BondUpdate{
 			PubKey: pubKey,
 			Bond:   bond,
 		},
 		description,
+		threshold,
+		pubKeySig,
 	}.Wrap()
 }
 
 // Wrap - Wrap a Tx as a Basecoin Tx
 func (tx TxDeclareCandidacy) Wrap() sdk.Tx { return sdk.Tx{tx} }
 
+// ValidateBasic - Check for a valid bond and a signature by the pubkey, the
+// signature itself is verified against the owner in CheckTx
+func (tx TxDeclareCandidacy) ValidateBasic() error {
+	if err := tx.BondUpdate.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := tx.Threshold.ValidateBasic(); err != nil {
+		return err
+	}
+	if tx.PubKeySig.Empty() {
+		return ErrMissingPubKeySig()
+	}
+	return nil
+}
+
+// candidacyProof - what the consensus key signs to declare a candidacy
+type candidacyProof struct {
+	ChainID string    `json:"chain_id"`
+	Owner   sdk.Actor `json:"owner"`
+}
+
+// CandidacySignBytes - the bytes the consensus private key signs for
+// TxDeclareCandidacy.PubKeySig and TxRotateConsensusKey.NewPubKeySig,
+// binding the candidacy to its owner on the chain so that the signature
+// can't be replayed by anybody else
+func CandidacySignBytes(chainID string, owner sdk.Actor) []byte {
+	return wire.BinaryBytes(candidacyProof{chainID, owner})
+}
+
 // TxEditCandidacy - struct for editing a candidate
 type TxEditCandidacy struct {
 	PubKey crypto.PubKey `json:"pub_key"`
 	Description
+	Threshold *SafetyThreshold `json:"safety_threshold,omitempty"` // replaces the threshold if set
 }
 
 // NewTxEditCandidacy - new TxEditCandidacy
@@ -96,10 +174,13 @@ func (tx TxEditCandidacy) Wrap() sdk.Tx { return sdk.Tx{tx} }
 
 // ValidateBasic - Check for non-empty candidate,
 func (tx TxEditCandidacy) ValidateBasic() error {
-	if tx.PubKey.Empty() {
-		return errCandidateEmpty
+	if err := validatePubKey(tx.PubKey); err != nil {
+		return err
 	}
 
+	if tx.Threshold != nil {
+		return tx.Threshold.ValidateBasic()
+	}
 	empty := Description{}
 	if tx.Description == empty {
 		return fmt.Errorf("Transaction must include some information to modify")
@@ -140,8 +221,8 @@ func (tx TxUnbond) Wrap() sdk.Tx { return sdk.Tx{tx} }
 
 // ValidateBasic - Check for non-empty candidate, positive shares
 func (tx TxUnbond) ValidateBasic() error {
-	if tx.PubKey.Empty() {
-		return errCandidateEmpty
+	if err := validatePubKey(tx.PubKey); err != nil {
+		return err
 	}
 
 	if tx.Shares == 0 {
@@ -149,3 +230,182 @@ func (tx TxUnbond) ValidateBasic() error {
 	}
 	return nil
 }
+
+// TxStakeBatch - ordered list of delegate, unbond and edit-candidacy
+// transactions which are applied atomically, either all succeed or none
+type TxStakeBatch struct {
+	Txs []sdk.Tx `json:"txs"`
+}
+
+// NewTxStakeBatch - new TxStakeBatch
+func NewTxStakeBatch(txs []sdk.Tx) sdk.Tx {
+	return TxStakeBatch{
+		Txs: txs,
+	}.Wrap()
+}
+
+// Wrap - Wrap a Tx as a Basecoin Tx
+func (tx TxStakeBatch) Wrap() sdk.Tx { return sdk.Tx{tx} }
+
+// ValidateBasic - Check for a non-empty batch of valid, batchable txs
+func (tx TxStakeBatch) ValidateBasic() error {
+	if len(tx.Txs) == 0 {
+		return errBatchEmpty
+	}
+	for i, inner := range tx.Txs {
+		switch inner.Unwrap().(type) {
+		case TxDelegate, TxUnbond, TxEditCandidacy:
+		default:
+			return ErrBadBatchTx(i)
+		}
+		if err := inner.ValidateBasic(); err != nil {
+			return fmt.Errorf("batch tx %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// TxRevokeCandidacy - withdraw a candidacy, unbonding all its delegators,
+// signed by the candidate's owner
+type TxRevokeCandidacy struct {
+	PubKey crypto.PubKey `json:"pub_key"`
+}
+
+// NewTxRevokeCandidacy - new TxRevokeCandidacy
+func NewTxRevokeCandidacy(pubKey crypto.PubKey) sdk.Tx {
+	return TxRevokeCandidacy{
+		PubKey: pubKey,
+	}.Wrap()
+}
+
+// Wrap - Wrap a Tx as a Basecoin Tx
+func (tx TxRevokeCandidacy) Wrap() sdk.Tx { return sdk.Tx{tx} }
+
+// ValidateBasic - Check for a usable candidate pubkey
+func (tx TxRevokeCandidacy) ValidateBasic() error {
+	return validatePubKey(tx.PubKey)
+}
+
+// TxWithdrawPool - take the sender's coins out of the liquid pool of a
+// candidate which left the validator set
+type TxWithdrawPool struct {
+	PubKey crypto.PubKey `json:"pub_key"`
+}
+
+// NewTxWithdrawPool - new TxWithdrawPool
+func NewTxWithdrawPool(pubKey crypto.PubKey) sdk.Tx {
+	return TxWithdrawPool{
+		PubKey: pubKey,
+	}.Wrap()
+}
+
+// Wrap - Wrap a Tx as a Basecoin Tx
+func (tx TxWithdrawPool) Wrap() sdk.Tx { return sdk.Tx{tx} }
+
+// ValidateBasic - Check for a usable candidate pubkey
+func (tx TxWithdrawPool) ValidateBasic() error {
+	return validatePubKey(tx.PubKey)
+}
+
+// TxRotateConsensusKey - move a candidate and all the bonds to it from its
+// current consensus pubkey to a new one, signed by the candidate's owner.
+// NewPubKeySig proves the owner holds the new consensus private key, it
+// signs the CandidacySignBytes of the chain and the owner.
+type TxRotateConsensusKey struct {
+	PubKey       crypto.PubKey    `json:"pub_key"`
+	NewPubKey    crypto.PubKey    `json:"new_pub_key"`
+	NewPubKeySig crypto.Signature `json:"new_pub_key_sig"`
+}
+
+// NewTxRotateConsensusKey - new TxRotateConsensusKey
+func NewTxRotateConsensusKey(pubKey, newPubKey crypto.PubKey, newPubKeySig crypto.Signature) sdk.Tx {
+	return TxRotateConsensusKey{
+		PubKey:       pubKey,
+		NewPubKey:    newPubKey,
+		NewPubKeySig: newPubKeySig,
+	}.Wrap()
+}
+
+// Wrap - Wrap a Tx as a Basecoin Tx
+func (tx TxRotateConsensusKey) Wrap() sdk.Tx { return sdk.Tx{tx} }
+
+// ValidateBasic - Check for two different, usable candidate pubkeys and a
+// signature by the new pubkey, verified against the owner in CheckTx
+func (tx TxRotateConsensusKey) ValidateBasic() error {
+	if err := validatePubKey(tx.PubKey); err != nil {
+		return err
+	}
+	if err := validatePubKey(tx.NewPubKey); err != nil {
+		return err
+	}
+	if tx.PubKey.Equals(tx.NewPubKey) {
+		return fmt.Errorf("New pubkey must differ from the current pubkey")
+	}
+	if tx.NewPubKeySig.Empty() {
+		return ErrMissingPubKeySig()
+	}
+	return nil
+}
+
+// TxTransferOwnership - hand a candidate and the owner's self-bond over to a
+// new owner, signed by the current owner
+type TxTransferOwnership struct {
+	PubKey   crypto.PubKey `json:"pub_key"`
+	NewOwner sdk.Actor     `json:"new_owner"`
+}
+
+// NewTxTransferOwnership - new TxTransferOwnership
+func NewTxTransferOwnership(pubKey crypto.PubKey, newOwner sdk.Actor) sdk.Tx {
+	return TxTransferOwnership{
+		PubKey:   pubKey,
+		NewOwner: newOwner,
+	}.Wrap()
+}
+
+// Wrap - Wrap a Tx as a Basecoin Tx
+func (tx TxTransferOwnership) Wrap() sdk.Tx { return sdk.Tx{tx} }
+
+// ValidateBasic - Check for a usable candidate pubkey and a new owner
+func (tx TxTransferOwnership) ValidateBasic() error {
+	if err := validatePubKey(tx.PubKey); err != nil {
+		return err
+	}
+	if tx.NewOwner.Empty() {
+		return fmt.Errorf("New owner cannot be empty")
+	}
+	return nil
+}
+
+// TxActAs - run a stake tx for the actor, such as a role, instead of the
+// tx's single signer. The actor must be among the tx's permissions, so a
+// role's signature threshold applies to its delegations.
+type TxActAs struct {
+	Actor sdk.Actor `json:"actor"`
+	Tx    sdk.Tx    `json:"tx"`
+}
+
+// NewTxActAs - new TxActAs
+func NewTxActAs(actor sdk.Actor, tx sdk.Tx) sdk.Tx {
+	return TxActAs{
+		Actor: actor,
+		Tx:    tx,
+	}.Wrap()
+}
+
+// Wrap - Wrap a Tx as a Basecoin Tx
+func (tx TxActAs) Wrap() sdk.Tx { return sdk.Tx{tx} }
+
+// ValidateBasic - Check for an actor and a valid stake tx to run for it
+func (tx TxActAs) ValidateBasic() error {
+	if tx.Actor.Empty() {
+		return fmt.Errorf("Actor cannot be empty")
+	}
+	switch tx.Tx.Unwrap().(type) {
+	case TxDeclareCandidacy, TxEditCandidacy, TxDelegate, TxUnbond,
+		TxStakeBatch, TxRotateConsensusKey, TxTransferOwnership, TxRevokeCandidacy,
+		TxWithdrawPool:
+	default:
+		return errBadActAsTx
+	}
+	return tx.Tx.ValidateBasic()
+}
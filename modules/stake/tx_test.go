@@ -53,6 +53,49 @@ func TestBondUpdateValidateBasic(t *testing.T) {
 	}
 }
 
+// foreignPubKey is a key type the consensus engine doesn't know about
+type foreignPubKey [8]byte
+
+func init() {
+	crypto.PubKeyMapper.RegisterImplementation(foreignPubKey{}, "foreign", 0x7f)
+}
+
+// nolint - crypto.PubKeyInner
+func (pk foreignPubKey) AssertIsPubKeyInner()                              {}
+func (pk foreignPubKey) Address() []byte                                   { return pk[:] }
+func (pk foreignPubKey) Bytes() []byte                                     { return wire.BinaryBytes(crypto.PubKey{pk}) }
+func (pk foreignPubKey) KeyString() string                                 { return "foreign" }
+func (pk foreignPubKey) VerifyBytes(msg []byte, sig crypto.Signature) bool { return false }
+func (pk foreignPubKey) Equals(other crypto.PubKey) bool                   { return false }
+func (pk foreignPubKey) Wrap() crypto.PubKey                               { return crypto.PubKey{pk} }
+
+func TestValidatePubKey(t *testing.T) {
+	var secp crypto.PubKeySecp256k1
+	secp[0] = 0x02
+
+	tests := []struct {
+		name    string
+		pubKey  crypto.PubKey
+		wantErr bool
+	}{
+		{"ed25519", pk1, false},
+		{"secp256k1", secp.Wrap(), false},
+		{"empty", crypto.PubKey{}, true},
+		{"unknown to consensus", foreignPubKey{}.Wrap(), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := TxDelegate{BondUpdate{
+				PubKey: tt.pubKey,
+				Bond:   coinPos,
+			}}
+			assert.Equal(t, tt.wantErr, tx.ValidateBasic() != nil,
+				"test: %v, tx.ValidateBasic: %v", tt.name, tx.ValidateBasic())
+		})
+	}
+}
+
 func TestAllAreTx(t *testing.T) {
 	assert := assert.New(t)
 
@@ -72,13 +115,44 @@ func TestAllAreTx(t *testing.T) {
 	_, ok = txUnbond.Unwrap().(TxUnbond)
 	assert.True(ok, "%#v", txUnbond)
 
-	txDecl := NewTxDeclareCandidacy(bond, pubKey, Description{})
+	txDecl := NewTxDeclareCandidacy(bond, pubKey, Description{}, SafetyThreshold{}, crypto.Signature{})
 	_, ok = txDecl.Unwrap().(TxDeclareCandidacy)
 	assert.True(ok, "%#v", txDecl)
 
 	txEditCan := NewTxEditCandidacy(pubKey, Description{})
 	_, ok = txEditCan.Unwrap().(TxEditCandidacy)
 	assert.True(ok, "%#v", txEditCan)
+
+	txBatch := NewTxStakeBatch([]sdk.Tx{txDelegate, txUnbond})
+	_, ok = txBatch.Unwrap().(TxStakeBatch)
+	assert.True(ok, "%#v", txBatch)
+}
+
+func TestTxStakeBatchValidateBasic(t *testing.T) {
+	delegate := NewTxDelegate(coinPos, pk1)
+	unbond := NewTxUnbond(10, pk1)
+	edit := NewTxEditCandidacy(pk1, Description{Moniker: "foo"})
+
+	tests := []struct {
+		name    string
+		txs     []sdk.Tx
+		wantErr bool
+	}{
+		{"basic good", []sdk.Tx{delegate, unbond, edit}, false},
+		{"empty", nil, true},
+		{"invalid inner tx", []sdk.Tx{delegate, NewTxUnbond(0, pk1)}, true},
+		{"declare candidacy", []sdk.Tx{NewTxDeclareCandidacy(coinPos, pk2, Description{}, SafetyThreshold{}, crypto.Signature{})}, true},
+		{"nested batch", []sdk.Tx{NewTxStakeBatch([]sdk.Tx{delegate})}, true},
+		{"nil tx", []sdk.Tx{delegate, {}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := TxStakeBatch{tt.txs}
+			assert.Equal(t, tt.wantErr, tx.ValidateBasic() != nil,
+				"test: %v, tx.ValidateBasic: %v", tt.name, tx.ValidateBasic())
+		})
+	}
 }
 
 func TestSerializeTx(t *testing.T) {
@@ -93,8 +167,9 @@ func TestSerializeTx(t *testing.T) {
 		tx sdk.Tx
 	}{
 		{NewTxUnbond(bondAmt, pubKey)},
-		{NewTxDeclareCandidacy(bond, pubKey, Description{})},
-		{NewTxDeclareCandidacy(bond, pubKey, Description{})},
+		{NewTxDeclareCandidacy(bond, pubKey, Description{}, SafetyThreshold{}, crypto.Signature{})},
+		{NewTxDeclareCandidacy(bond, pubKey, Description{}, SafetyThreshold{}, crypto.Signature{})},
+		{NewTxStakeBatch([]sdk.Tx{NewTxDelegate(bond, pubKey), NewTxUnbond(bondAmt, pubKey)})},
 		// {NewTxRevokeCandidacy(pubKey)},
 	}
 
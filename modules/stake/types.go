@@ -2,6 +2,7 @@ package stake
 
 import (
 	"bytes"
+	"fmt"
 	"sort"
 
 	"github.com/cosmos/cosmos-sdk"
@@ -13,10 +14,14 @@ import (
 )
 
 // Params defines the high level settings for staking
+// NOTE the params are stored with go-wire, which decodes the fields by
+// position, so the params of a chain started before a field was added can't
+// be read, it must start from a new genesis
 type Params struct {
 	HoldAccount sdk.Actor `json:"hold_account"` // PubKey where all bonded coins are held
 
 	MaxVals          uint16 `json:"max_vals"`           // maximum number of validators
+	MinValidators    uint16 `json:"min_validators"`     // validators kept whatever happens to their candidates
 	AllowedBondDenom string `json:"allowed_bond_denom"` // bondable coin denomination
 
 	// gas costs for txs
@@ -24,17 +29,59 @@ type Params struct {
 	GasEditCandidacy    int64 `json:"gas_edit_candidacy"`
 	GasDelegate         int64 `json:"gas_delegate"`
 	GasUnbond           int64 `json:"gas_unbond"`
+
+	GasRotateConsensusKey int64 `json:"gas_rotate_consensus_key"`
+	GasTransferOwnership  int64 `json:"gas_transfer_ownership"`
+	GasRevokeCandidacy    int64 `json:"gas_revoke_candidacy"`
+	GasWithdrawPool       int64 `json:"gas_withdraw_pool"`
+
+	// number of blocks the validator set history is kept for, 0 keeps all
+	ValidatorHistory int64 `json:"validator_history"`
+	// number of blocks between validator set updates
+	EpochLength int64 `json:"epoch_length"`
+
+	// most voting power the validator updates of a block may move, in basis
+	// points of the total power, the rest is deferred. 0 disables the limit.
+	MaxPowerChurn uint64 `json:"max_power_churn"`
+	// most voting power a validator may have, in basis points of the total
+	// power, power beyond it is clipped. 0 disables the cap.
+	MaxPowerFraction uint64 `json:"max_power_fraction"`
+
+	// name of the SelectionPolicy choosing the validators among candidates
+	SelectionPolicy string `json:"selection_policy"`
+	// name of the PowerFunction giving the voting power of the shares, and
+	// the shares beyond which the capped-log power grows logarithmically
+	PowerFunction string `json:"power_function"`
+	PowerLogKnee  uint64 `json:"power_log_knee"`
+
+	// smallest bonds in coins an owner can keep in their candidate and any
+	// other delegator can keep in a candidate, unless unbonding everything.
+	// A candidate whose owner self-bonds less doesn't validate.
+	MinSelfBond   int64 `json:"min_self_bond"`
+	MinDelegation int64 `json:"min_delegation"`
 }
 
 func defaultParams() Params {
 	return Params{
 		HoldAccount:         sdk.NewActor(stakingModuleName, []byte("77777777777777777777777777777777")),
 		MaxVals:             100,
+		MinValidators:       1,
 		AllowedBondDenom:    "fermion",
 		GasDeclareCandidacy: 20,
 		GasEditCandidacy:    20,
 		GasDelegate:         20,
 		GasUnbond:           20,
+		ValidatorHistory:    1000,
+		EpochLength:         1,
+		SelectionPolicy:     SelectionPubKey,
+		MaxPowerChurn:       3333, // below the third Tendermint's light clients rely on
+		PowerFunction:       PowerLinear,
+		PowerLogKnee:        1000,
+
+		GasRotateConsensusKey: 20,
+		GasTransferOwnership:  20,
+		GasRevokeCandidacy:    20,
+		GasWithdrawPool:       20,
 	}
 }
 
@@ -48,12 +95,19 @@ func defaultParams() Params {
 // exchange rate. Voting power can be calculated as total bonds multiplied by
 // exchange rate.
 // NOTE if the Owner.Empty() == true then this is a candidate who has revoked candidacy
+// NOTE the candidates are stored with go-wire like the Params, a field added
+// needs a new genesis
 type Candidate struct {
 	PubKey      crypto.PubKey `json:"pub_key"`      // Pubkey of candidate
 	Owner       sdk.Actor     `json:"owner"`        // Sender of BondTx - UnbondTx returns here
 	Shares      uint64        `json:"shares"`       // Total number of delegated shares to this candidate, equivalent to coins held in bond account
 	VotingPower uint64        `json:"voting_power"` // Voting power if pubKey is a considered a validator
+	RawPower    uint64        `json:"raw_power"`    // Voting power before the Params.MaxPowerFraction cap
 	Description Description   `json:"description"`  // Description terms for the candidate
+
+	DeclareHeight int64 `json:"declare_height"` // Block height the candidacy was declared at
+
+	Threshold SafetyThreshold `json:"safety_threshold"` // Limits set by the owner to stop validating
 }
 
 // Description - description fields for a candidate
@@ -64,6 +118,38 @@ type Description struct {
 	Details  string `json:"details"`
 }
 
+// SafetyThreshold - limits the owner puts on their candidate, a candidate
+// crossing them doesn't validate and takes no delegations which would cross
+// them further. A zero value disables the limit.
+type SafetyThreshold struct {
+	// smallest part of all the shares the owner must hold, in basis points
+	MinSelfBondRatio uint64 `json:"min_self_bond_ratio"`
+	// most coins which may be bonded to the candidate in total
+	MaxTotalDelegation int64 `json:"max_total_delegation"`
+}
+
+// maxRatio - a ratio of all, in basis points
+const maxRatio = 10000
+
+// mulDiv - a*b/c rounded down, and whether anything was rounded off. a is
+// divided first so a*b can't overflow, b and c must be small, such as basis
+// points, for the remainder times b to fit.
+func mulDiv(a, b, c uint64) (quo uint64, rounded bool) {
+	rem := a % c * b
+	return a/c*b + rem/c, rem%c != 0
+}
+
+// ValidateBasic - Check the ratio is at most all the shares
+func (t SafetyThreshold) ValidateBasic() error {
+	if t.MinSelfBondRatio > maxRatio {
+		return fmt.Errorf("Min self-bond ratio cannot be more than %d basis points", maxRatio)
+	}
+	if t.MaxTotalDelegation < 0 {
+		return fmt.Errorf("Max total delegation cannot be negative")
+	}
+	return nil
+}
+
 // NewCandidate - initialize a new candidate
 func NewCandidate(pubKey crypto.PubKey, owner sdk.Actor) *Candidate {
 	return &Candidate{
@@ -74,6 +160,51 @@ func NewCandidate(pubKey crypto.PubKey, owner sdk.Actor) *Candidate {
 	}
 }
 
+// SharesFromCoins - the number of this candidate's bond shares which are
+// worth the amount of bonded coins. Currently each share is worth one coin,
+// this changes once rewards and slashing modify the exchange rate.
+func (c *Candidate) SharesFromCoins(amount int64) uint64 {
+	return uint64(amount)
+}
+
+// CoinsFromShares - the amount of bonded coins which the number of this
+// candidate's bond shares are worth
+func (c *Candidate) CoinsFromShares(shares uint64) int64 {
+	return int64(shares)
+}
+
+// crossesThreshold - whether the candidate with the shares, of which the
+// owner holds selfShares, is beyond its safety threshold
+func (c *Candidate) crossesThreshold(shares, selfShares uint64) bool {
+	t := c.Threshold
+	if t.MaxTotalDelegation > 0 && c.CoinsFromShares(shares) > t.MaxTotalDelegation {
+		return true
+	}
+	if t.MinSelfBondRatio == 0 {
+		return false
+	}
+
+	// selfShares/shares < ratio/maxRatio, so below the ratio of the shares
+	// rounded up
+	min, rounded := mulDiv(shares, t.MinSelfBondRatio, maxRatio)
+	if rounded {
+		min++
+	}
+	return selfShares < min
+}
+
+// selfShares - the shares of the owner's bond to the candidate
+func (c *Candidate) selfShares(store state.SimpleDB) uint64 {
+	if c.Owner.Empty() {
+		return 0
+	}
+	bond := loadDelegatorBond(store, c.Owner, c.PubKey)
+	if bond == nil {
+		return 0
+	}
+	return bond.Shares
+}
+
 // Validator returns a copy of the Candidate as a Validator.
 // Should only be called when the Candidate qualifies as a validator.
 func (c *Candidate) validator() Validator {
@@ -86,11 +217,25 @@ type Validator Candidate
 // ABCIValidator - Get the validator from a bond value
 func (v Validator) ABCIValidator() *abci.Validator {
 	return &abci.Validator{
-		PubKey: wire.BinaryBytes(v.PubKey),
+		PubKey: pubKeyBytes(v.PubKey),
 		Power:  int64(v.VotingPower),
 	}
 }
 
+// removedABCIValidator - the update removing the validator from Tendermint
+func (v Validator) removedABCIValidator() *abci.Validator {
+	return &abci.Validator{
+		PubKey: pubKeyBytes(v.PubKey),
+		Power:  0,
+	}
+}
+
+// pubKeyBytes - the encoding of a validator pubkey sent to Tendermint, also
+// used to order and compare the validators
+func pubKeyBytes(pk crypto.PubKey) []byte {
+	return wire.BinaryBytes(pk)
+}
+
 //_________________________________________________________________________
 
 // TODO replace with sorted multistore functionality
@@ -105,7 +250,7 @@ func (cs Candidates) Len() int      { return len(cs) }
 func (cs Candidates) Swap(i, j int) { cs[i], cs[j] = cs[j], cs[i] }
 func (cs Candidates) Less(i, j int) bool {
 	vp1, vp2 := cs[i].VotingPower, cs[j].VotingPower
-	pk1, pk2 := cs[i].PubKey.Bytes(), cs[j].PubKey.Bytes()
+	pk1, pk2 := pubKeyBytes(cs[i].PubKey), pubKeyBytes(cs[j].PubKey)
 
 	//note that all ChainId and App must be the same for a group of candidates
 	if vp1 != vp2 {
@@ -124,47 +269,131 @@ func (cs Candidates) Sort() {
 //candidates.updateVotingPower(store)
 //}
 
-// update the voting power and save
-func (cs Candidates) updateVotingPower(store state.SimpleDB) Candidates {
+// update the voting power of the candidates eligible under the selection
+// policy, given by the power function, keeping only the top MaxVals, and save
+func (cs Candidates) updateVotingPower(store state.SimpleDB) (Candidates, error) {
+	params := loadParams(store)
+	policy, err := GetSelectionPolicy(params.SelectionPolicy)
+	if err != nil {
+		return cs, err
+	}
+	power, err := GetPowerFunction(params.PowerFunction)
+	if err != nil {
+		return cs, err
+	}
 
-	// update voting power
+	// update voting power, candidates beyond their own safety threshold or
+	// without the min self-bond don't validate whatever the policy
 	for _, c := range cs {
-		if c.VotingPower != c.Shares {
-			c.VotingPower = c.Shares
+		c.VotingPower = 0
+		if c.crossesThreshold(c.Shares, c.selfShares(store)) {
+			continue
+		}
+		if hasMinSelfBond(store, params, c) && policy.Eligible(store, params, c) {
+			c.VotingPower = power(params, c.Shares)
 		}
 	}
-	cs.Sort()
+	cs.sortByPolicy(policy)
 	for i, c := range cs {
 		// truncate the power
-		if i >= int(loadParams(store).MaxVals) {
+		if i >= int(params.MaxVals) {
 			c.VotingPower = 0
 		}
 		saveCandidate(store, c)
 	}
-	return cs
+	return cs, nil
 }
 
-// Validators - get the most recent updated validator set from the
-// Candidates. These bonds are already sorted by VotingPower from
-// the UpdateVotingPower function which is the only function which
-// is to modify the VotingPower
-func (cs Candidates) Validators() Validators {
-
-	//test if empty
-	if len(cs) == 1 {
-		if cs[0].VotingPower == 0 {
-			return nil
+// keepValidators - keep the validators vs1 before the update validating, the
+// most powerful first, while the candidates have fewer validators than the
+// Params.MinValidators, so the chain doesn't halt before replacements join.
+// The kept candidates get the power of their shares, the validators whose
+// candidate has been removed are returned with their power before. This only
+// sets the target of the update, keepMinValidators keeps the minimum of the
+// validators sent once the churn is limited.
+func (cs Candidates) keepValidators(store state.SimpleDB, vs1 Validators,
+	power PowerFunction) (kept Validators) {
+
+	params := loadParams(store)
+	min := int(params.MinValidators)
+	count := len(cs.Validators())
+	if count >= min {
+		return nil
+	}
+
+	candidates := make(map[string]*Candidate, len(cs))
+	for _, c := range cs {
+		candidates[c.PubKey.KeyString()] = c
+	}
+	byPower := make(Candidates, len(vs1))
+	for i, v := range vs1 {
+		c := Candidate(v)
+		byPower[i] = &c
+	}
+	byPower.Sort()
+
+	for _, v := range byPower {
+		if count >= min {
+			break
 		}
+		c := candidates[v.PubKey.KeyString()]
+		switch {
+		case c == nil:
+			kept = append(kept, v.validator())
+		case c.VotingPower == 0:
+			c.VotingPower = power(params, c.Shares)
+			saveCandidate(store, c)
+		default:
+			continue // still validating
+		}
+		count++
 	}
+	return kept
+}
 
-	validators := make(Validators, len(cs))
-	for i, c := range cs {
-		if c.VotingPower == 0 { //exit as soon as the first Voting power set to zero is found
-			return validators[:i]
+// keepMinValidators - add the validators vs1 before the update which are
+// missing from the validators vs2 back to them, the most powerful first and
+// with their power before, while vs2 has fewer than min. The churn may remove
+// validators before their replacements join, or several may leave at once.
+func (vs2 Validators) keepMinValidators(vs1 Validators, min int) Validators {
+	if len(vs2) >= min {
+		return vs2
+	}
+
+	validates := make(map[string]bool, len(vs2))
+	for _, v := range vs2 {
+		validates[v.PubKey.KeyString()] = true
+	}
+	byPower := make(Candidates, len(vs1))
+	for i, v := range vs1 {
+		c := Candidate(v)
+		byPower[i] = &c
+	}
+	byPower.Sort()
+
+	kept := append(Validators{}, vs2...)
+	for _, c := range byPower {
+		if len(kept) >= min {
+			break
+		}
+		if !validates[c.PubKey.KeyString()] {
+			kept = append(kept, c.validator())
 		}
-		validators[i] = c.validator()
 	}
+	kept.Sort()
+	return kept
+}
 
+// Validators - get the most recent updated validator set from the
+// Candidates, which are all the candidates with voting power. The
+// VotingPower is only modified by the UpdateVotingPower function, so the
+// candidates don't need to be sorted.
+func (cs Candidates) Validators() (validators Validators) {
+	for _, c := range cs {
+		if c.VotingPower != 0 {
+			validators = append(validators, c.validator())
+		}
+	}
 	return validators
 }
 
@@ -179,7 +408,7 @@ var _ sort.Interface = Validators{} //enforce the sort interface at compile time
 func (vs Validators) Len() int      { return len(vs) }
 func (vs Validators) Swap(i, j int) { vs[i], vs[j] = vs[j], vs[i] }
 func (vs Validators) Less(i, j int) bool {
-	pk1, pk2 := vs[i].PubKey.Bytes(), vs[j].PubKey.Bytes()
+	pk1, pk2 := pubKeyBytes(vs[i].PubKey), pubKeyBytes(vs[j].PubKey)
 	return bytes.Compare(pk1, pk2) == -1
 }
 
@@ -188,65 +417,213 @@ func (vs Validators) Sort() {
 	sort.Sort(vs)
 }
 
-// determine all changed validators between two validator sets
+// determine all changed validators between two validator sets, neither set
+// needs to be sorted and both are left unchanged
 func (vs Validators) validatorsChanged(vs2 Validators) (changed []*abci.Validator) {
 
-	//first sort the validator sets
-	vs.Sort()
+	//first sort copies of the validator sets
+	vs1 := append(Validators{}, vs...)
+	vs2 = append(Validators{}, vs2...)
+	vs1.Sort()
 	vs2.Sort()
 
-	max := len(vs) + len(vs2)
-	changed = make([]*abci.Validator, max)
-	i, j, n := 0, 0, 0 //counters for vs loop, vs2 loop, changed element
-
-	for i < len(vs) && j < len(vs2) {
-
-		if !vs[i].PubKey.Equals(vs2[j].PubKey) {
-			// pk1 > pk2, a new validator was introduced between these pubkeys
-			if bytes.Compare(vs[i].PubKey.Bytes(), vs2[j].PubKey.Bytes()) == 1 {
-				changed[n] = vs2[j].ABCIValidator()
-				n++
-				j++
-				continue
-			} // else, the old validator has been removed
-			changed[n] = &abci.Validator{vs[i].PubKey.Bytes(), 0}
-			n++
+	i, j := 0, 0 //counters for vs1 loop, vs2 loop
+	for i < len(vs1) && j < len(vs2) {
+		switch bytes.Compare(pubKeyBytes(vs1[i].PubKey), pubKeyBytes(vs2[j].PubKey)) {
+		case 1: // pk1 > pk2, a new validator was introduced between these pubkeys
+			changed = append(changed, vs2[j].ABCIValidator())
+			j++
+		case -1: // the old validator has been removed
+			changed = append(changed, vs1[i].removedABCIValidator())
 			i++
-			continue
-		}
-
-		if vs[i].VotingPower != vs2[j].VotingPower {
-			changed[n] = vs2[j].ABCIValidator()
-			n++
+		default:
+			if vs1[i].VotingPower != vs2[j].VotingPower {
+				changed = append(changed, vs2[j].ABCIValidator())
+			}
+			i++
+			j++
 		}
-		j++
-		i++
 	}
 
 	// add any excess validators in set 2
-	for ; j < len(vs2); j, n = j+1, n+1 {
-		changed[n] = vs2[j].ABCIValidator()
+	for ; j < len(vs2); j++ {
+		changed = append(changed, vs2[j].ABCIValidator())
 	}
 
 	// remove any excess validators left in set 1
-	for ; i < len(vs); i, n = i+1, n+1 {
-		changed[n] = &abci.Validator{vs[i].PubKey.Bytes(), 0}
+	for ; i < len(vs1); i++ {
+		changed = append(changed, vs1[i].removedABCIValidator())
+	}
+
+	return changed
+}
+
+// ValidatorPower - a validator of the historical validator sets
+type ValidatorPower struct {
+	PubKey crypto.PubKey `json:"pub_key"`
+	Power  uint64        `json:"power"`
+}
+
+// ValidatorSetInfo - the validator set stored for a height. The validators
+// are only stored at the height the set changed, the following heights point
+// back to it with ChangedHeight.
+type ValidatorSetInfo struct {
+	ChangedHeight int64            `json:"changed_height"`
+	Validators    []ValidatorPower `json:"validators"`
+}
+
+// powers - the pubkeys and voting powers of the validators
+func (vs Validators) powers() []ValidatorPower {
+	powers := make([]ValidatorPower, len(vs))
+	for i, v := range vs {
+		powers[i] = ValidatorPower{v.PubKey, v.VotingPower}
 	}
+	return powers
+}
 
-	return changed[:n]
+// validatorsFromPowers - the validators of a stored validator set
+func validatorsFromPowers(powers []ValidatorPower) Validators {
+	vs := make(Validators, len(powers))
+	for i, p := range powers {
+		vs[i] = Validator{PubKey: p.PubKey, VotingPower: p.Power}
+	}
+	return vs
+}
+
+// keyRotation - a candidate moved from the consensus key Old to New by
+// TxRotateConsensusKey since the validator set was last updated
+type keyRotation struct {
+	Old crypto.PubKey `json:"old"`
+	New crypto.PubKey `json:"new"`
+}
+
+// rotateValidators - the validators with the new key of each rotation in
+// place of the old one, keeping its power, so that the update swaps them
+// outside of the churn limit. The new key must still be a candidate.
+func rotateValidators(store state.SimpleDB, vs Validators,
+	rotations []keyRotation) Validators {
+
+	newKeys := make(map[string]crypto.PubKey, len(rotations))
+	for _, r := range rotations {
+		if loadCandidate(store, r.New) != nil {
+			newKeys[r.Old.KeyString()] = r.New
+		}
+	}
+
+	rotated := make(Validators, len(vs))
+	for i, v := range vs {
+		if pk, ok := newKeys[v.PubKey.KeyString()]; ok {
+			v.PubKey = pk
+		}
+		rotated[i] = v
+	}
+	rotated.Sort()
+	return rotated
+}
+
+// ValidatorChange - a change of a validator's voting power, recorded as an
+// event for the height it was reported to Tendermint at
+type ValidatorChange struct {
+	PubKey crypto.PubKey `json:"pub_key"`
+	Before uint64        `json:"before"` // zero for a new validator
+	After  uint64        `json:"after"`  // zero for a removed validator
+}
+
+// pair the changes reported to Tendermint with the power before the change
+func validatorChangeEvents(vs Validators, changed []*abci.Validator) ([]ValidatorChange, error) {
+	before := make(map[string]uint64, len(vs))
+	for _, v := range vs {
+		before[string(pubKeyBytes(v.PubKey))] = v.VotingPower
+	}
+
+	events := make([]ValidatorChange, len(changed))
+	for i, c := range changed {
+		pk, err := crypto.PubKeyFromBytes(c.PubKey)
+		if err != nil {
+			return nil, err
+		}
+		events[i] = ValidatorChange{
+			PubKey: pk,
+			Before: before[string(c.PubKey)],
+			After:  uint64(c.Power),
+		}
+	}
+	return events, nil
 }
 
 // UpdateValidatorSet - Updates the voting power for the candidate set and
-// returns the subset of validators which have changed for Tendermint
-func UpdateValidatorSet(store state.SimpleDB) (change []*abci.Validator, err error) {
+// returns the subset of validators which have changed for Tendermint. The
+// changes are also saved as events for the height, and the new set is saved
+// for the next height, the first block it validates. Changes beyond the
+// Params.MaxPowerChurn are deferred, they're saved for the height and made
+// by the next updates. The set is only updated at the end of each epoch of
+// Params.EpochLength blocks, before that it is carried over unchanged. A
+// validator whose consensus key was rotated is swapped to the new key at
+// once, with the same power. The bonds moved into or out of the liquid pools
+// are saved as events for the height too.
+func UpdateValidatorSet(store state.SimpleDB, height int64) (change []*abci.Validator, err error) {
+
+	if !isEpochEnd(loadParams(store), height) {
+		if set := loadValidatorSet(store, height); set != nil {
+			saveValidatorSet(store, height+1, set)
+		}
+		return nil, nil
+	}
 
-	// get the validators before update
+	// get the validators before update, from the set stored for this height
+	// as it includes the validators whose candidacy has since been removed
 	candidates := loadCandidates(store)
 
 	v1 := candidates.Validators()
-	v2 := candidates.updateVotingPower(store).Validators()
+	if set := loadValidatorSet(store, height); set != nil {
+		v1 = validatorsFromPowers(set)
+	}
+
+	// the update is made from the validators with their keys rotated
+	rotated := rotateValidators(store, v1, loadKeyRotations(store))
+	saveKeyRotations(store, nil)
+
+	candidates, err = candidates.updateVotingPower(store)
+	if err != nil {
+		return nil, err
+	}
+	power, err := GetPowerFunction(loadParams(store).PowerFunction)
+	if err != nil {
+		return nil, err
+	}
+	kept := candidates.keepValidators(store, rotated, power)
+	candidates.capVotingPower(store)
+	target := append(candidates.Validators(), kept...)
+	target.capPower(loadParams(store).MaxPowerFraction)
+
+	// move the validators towards the target as far as the churn allows, the
+	// rest of the way is deferred
+	v2, err := applyValidatorChanges(rotated, limitChurn(rotated,
+		rotated.validatorsChanged(target), loadParams(store).MaxPowerChurn))
+	if err != nil {
+		return nil, err
+	}
+	v2 = v2.keepMinValidators(rotated, int(loadParams(store).MinValidators))
+	deferred, err := validatorChangeEvents(v2, v2.validatorsChanged(target))
+	if err != nil {
+		return nil, err
+	}
+	saveDeferredChanges(store, height, deferred)
+	saveValidatorSet(store, height+1, v2.powers())
+
+	// the delegators follow the candidates which actually leave or join
+	savePoolChanges(store, height, updateLiquidPools(store, rotated, v2, candidates))
 
 	change = v1.validatorsChanged(v2)
+	if len(change) == 0 {
+		return
+	}
+
+	events, err := validatorChangeEvents(v1, change)
+	if err != nil {
+		return nil, err
+	}
+	saveValidatorChanges(store, height, events)
 	return
 }
 
@@ -2,6 +2,8 @@ package stake
 
 import (
 	"fmt"
+	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -129,6 +131,33 @@ func TestUpdateVotingPower(t *testing.T) {
 	assert.Equal(uint64(0), candidates[4].VotingPower, "%v", candidates[4])
 }
 
+func TestCrossesThreshold(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		threshold          SafetyThreshold
+		shares, selfShares uint64
+		crosses            bool
+	}{
+		{SafetyThreshold{}, 1000, 0, false},
+		{SafetyThreshold{MinSelfBondRatio: 5000}, 200, 100, false},
+		{SafetyThreshold{MinSelfBondRatio: 5000}, 200, 99, true},
+		{SafetyThreshold{MinSelfBondRatio: 5000}, 201, 100, true}, // rounded up
+		{SafetyThreshold{MinSelfBondRatio: 5000}, 201, 101, false},
+		{SafetyThreshold{MaxTotalDelegation: 300}, 300, 0, false},
+		{SafetyThreshold{MaxTotalDelegation: 300}, 301, 301, true},
+		// shares times the basis points would overflow
+		{SafetyThreshold{MinSelfBondRatio: 5000}, 4000000000000000, 2000000000000000, false},
+		{SafetyThreshold{MinSelfBondRatio: 5000}, 4000000000000000, 1999999999999999, true},
+		{SafetyThreshold{MinSelfBondRatio: maxRatio}, math.MaxUint64, math.MaxUint64, false},
+		{SafetyThreshold{MinSelfBondRatio: maxRatio}, math.MaxUint64, math.MaxUint64 - 1, true},
+	}
+	for i, tc := range cases {
+		c := Candidate{Threshold: tc.threshold}
+		assert.Equal(tc.crosses, c.crossesThreshold(tc.shares, tc.selfShares), "case %d", i)
+	}
+}
+
 func TestGetValidators(t *testing.T) {
 	assert, require := assert.New(t), require.New(t)
 
@@ -192,14 +221,14 @@ func TestValidatorsChanged(t *testing.T) {
 	vs2 = Validators{v2, v4, v1}
 	changed = vs1.validatorsChanged(vs2)
 	require.Equal(1, len(changed))
-	testChange(t, vs2[0], changed[0])
+	testChange(t, v1, changed[0])
 
 	// test validator added in the middle
 	vs1 = Validators{v1, v2, v4}
 	vs2 = Validators{v3, v1, v4, v2}
 	changed = vs1.validatorsChanged(vs2)
 	require.Equal(1, len(changed))
-	testChange(t, vs2[2], changed[0])
+	testChange(t, v3, changed[0])
 
 	// test validator added at the end
 	vs2 = Validators{v1, v2, v4, v5}
@@ -263,15 +292,21 @@ func TestUpdateValidatorSet(t *testing.T) {
 	}
 
 	// They should all already be validators
-	change, err := UpdateValidatorSet(store)
+	change, err := UpdateValidatorSet(store, 1)
 	require.Nil(err)
 	require.Equal(0, len(change), "%v", change) // change 1, remove 1, add 2
 
+	// the set is stored for the next height
+	set := loadValidatorSet(store, 2)
+	require.Equal(N, len(set))
+	assert.Equal(ValidatorPower{candidates[0].PubKey, 400}, set[0])
+
 	// test the max value and test again
 	params := loadParams(store)
 	params.MaxVals = 4
+	params.MaxPowerChurn = 0
 	saveParams(store, params)
-	change, err = UpdateValidatorSet(store)
+	change, err = UpdateValidatorSet(store, 2)
 	require.Nil(err)
 	require.Equal(1, len(change), "%v", change)
 	testRemove(t, candidates[4].validator(), change[0])
@@ -287,7 +322,7 @@ func TestUpdateValidatorSet(t *testing.T) {
 	for _, c := range candidates {
 		saveCandidate(store, c)
 	}
-	change, err = UpdateValidatorSet(store)
+	change, err = UpdateValidatorSet(store, 3)
 	require.Nil(err)
 	require.Equal(5, len(change), "%v", change) //3 changed, 1 added, 1 removed
 	candidates = loadCandidates(store)
@@ -296,4 +331,322 @@ func TestUpdateValidatorSet(t *testing.T) {
 	testChange(t, candidates[2].validator(), change[2])
 	testRemove(t, candidates[3].validator(), change[3])
 	testChange(t, candidates[4].validator(), change[4])
+
+	assert.Equal(N-1, len(loadValidatorSet(store, 4)))
+
+	// the changes are recorded with the power before and after
+	assert.Nil(loadValidatorChanges(store, 1))
+	events := loadValidatorChanges(store, 2)
+	require.Equal(1, len(events))
+	assert.Equal(ValidatorChange{candidates[4].PubKey, 1, 0}, events[0])
+	events = loadValidatorChanges(store, 3)
+	require.Equal(len(change), len(events))
+	for i, e := range events {
+		assert.Equal(change[i].PubKey, e.PubKey.Bytes())
+		assert.Equal(uint64(change[i].Power), e.After)
+	}
+	assert.Equal(ValidatorChange{candidates[3].PubKey, 10, 0}, events[3])
+	assert.Equal(ValidatorChange{candidates[4].PubKey, 0, 10}, events[4])
+}
+
+// randomValidators - a random set of validators in random order, drawn from
+// the pubkeys so that sets share some of their validators
+func randomValidators(r *rand.Rand, pubKeys []crypto.PubKey) (vs Validators) {
+	for _, i := range r.Perm(len(pubKeys)) {
+		if r.Intn(2) == 0 {
+			continue
+		}
+		vs = append(vs, (&Candidate{
+			PubKey:      pubKeys[i],
+			VotingPower: uint64(1 + r.Intn(3)),
+		}).validator())
+	}
+	return
+}
+
+func randomPubKeys(r *rand.Rand, n int) (pubKeys []crypto.PubKey) {
+	for i := 0; i < n; i++ {
+		var pk crypto.PubKeyEd25519
+		r.Read(pk[:])
+		pubKeys = append(pubKeys, pk.Wrap())
+	}
+	return
+}
+
+// applyChanges - the validator set Tendermint has after applying changed to vs
+func applyChanges(vs Validators, changed []*abci.Validator) map[string]int64 {
+	set := make(map[string]int64)
+	for _, v := range vs {
+		set[string(v.PubKey.Bytes())] = int64(v.VotingPower)
+	}
+	for _, c := range changed {
+		if c.Power == 0 {
+			delete(set, string(c.PubKey))
+		} else {
+			set[string(c.PubKey)] = c.Power
+		}
+	}
+	return set
+}
+
+func TestValidatorsChangedProperties(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	r := rand.New(rand.NewSource(1))
+	pubKeys := randomPubKeys(r, 12)
+
+	for n := 0; n < 500; n++ {
+		vs1, vs2 := randomValidators(r, pubKeys), randomValidators(r, pubKeys)
+		order1 := append(Validators{}, vs1...)
+		order2 := append(Validators{}, vs2...)
+
+		changed := vs1.validatorsChanged(vs2)
+
+		// the inputs are left in their order
+		require.Equal(order1, vs1)
+		require.Equal(order2, vs2)
+
+		// applying the changes to the first set gives the second set
+		want := make(map[string]int64)
+		for _, v := range vs2 {
+			want[string(v.PubKey.Bytes())] = int64(v.VotingPower)
+		}
+		require.Equal(want, applyChanges(vs1, changed), "%v -> %v: %v", vs1, vs2, changed)
+
+		seen := make(map[string]bool)
+		for _, c := range changed {
+			// each validator changes once, with the key encoding of the set
+			require.False(seen[string(c.PubKey)], "duplicate change %X", c.PubKey)
+			seen[string(c.PubKey)] = true
+
+			pk, err := crypto.PubKeyFromBytes(c.PubKey)
+			require.NoError(err)
+			assert.Equal(c.PubKey, pubKeyBytes(pk))
+		}
+
+		// the diff back is the reverse change
+		back := vs2.validatorsChanged(vs1)
+		assert.Equal(len(changed), len(back))
+
+		// identical sets, in any order, don't change
+		shuffled := make(Validators, len(vs2))
+		for i, j := range r.Perm(len(vs2)) {
+			shuffled[i] = vs2[j]
+		}
+		assert.Empty(vs2.validatorsChanged(shuffled))
+	}
+}
+
+func TestUpdateValidatorSetProperties(t *testing.T) {
+	require := require.New(t)
+	r := rand.New(rand.NewSource(2))
+	pubKeys := randomPubKeys(r, 12)
+
+	store := state.NewMemKVStore()
+	params := loadParams(store)
+	params.MaxVals = 4
+	params.MaxPowerChurn = 0
+	params.MinValidators = 0
+	saveParams(store, params)
+
+	var tendermint Validators // the set as known by Tendermint
+	for height := int64(1); height <= 300; height++ {
+
+		// randomly declare, rebond and remove candidates
+		for _, pk := range pubKeys {
+			switch r.Intn(4) {
+			case 0:
+				if loadCandidate(store, pk) != nil {
+					removeCandidate(store, pk)
+				}
+			case 1:
+				c := loadCandidate(store, pk)
+				if c == nil {
+					c = NewCandidate(pk, sdk.Actor{})
+				}
+				c.Shares = uint64(1 + r.Intn(5))
+				saveCandidate(store, c)
+			}
+		}
+
+		change, err := UpdateValidatorSet(store, height)
+		require.NoError(err)
+		got := applyChanges(tendermint, change)
+
+		// the top MaxVals candidates by shares, then by pubkey
+		candidates := loadCandidates(store)
+		candidates.Sort()
+		want := make(map[string]int64)
+		tendermint = nil
+		for i, c := range candidates {
+			if i >= int(params.MaxVals) {
+				break
+			}
+			want[string(c.PubKey.Bytes())] = int64(c.Shares)
+			tendermint = append(tendermint, c.validator())
+		}
+		require.Equal(want, got, "height %d", height)
+	}
+}
+
+func TestLimitChurn(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	vs := Validators{
+		{PubKey: pks[0], VotingPower: 300},
+		{PubKey: pks[1], VotingPower: 300},
+		{PubKey: pks[2], VotingPower: 400},
+	}
+	changed := []*abci.Validator{
+		{PubKey: pubKeyBytes(pks[3]), Power: 200},
+		{PubKey: pubKeyBytes(pks[2]), Power: 500},
+		{PubKey: pubKeyBytes(pks[0]), Power: 0},
+	}
+
+	// no limit
+	assert.Equal(changed, limitChurn(vs, changed, 0))
+
+	// a third of 1000 is split between the removal and the increases
+	applied := limitChurn(vs, changed, 3333)
+	assert.Equal([]*abci.Validator{
+		{PubKey: pubKeyBytes(pks[0]), Power: 134},
+		{PubKey: pubKeyBytes(pks[2]), Power: 500},
+		{PubKey: pubKeyBytes(pks[3]), Power: 67},
+	}, applied)
+
+	// the increases leave more of it to the decreases once they're small
+	vs2, err := applyValidatorChanges(vs, applied)
+	require.NoError(err)
+	changed = []*abci.Validator{
+		{PubKey: pubKeyBytes(pks[0]), Power: 0},
+		{PubKey: pubKeyBytes(pks[3]), Power: 200},
+	}
+	assert.Equal(changed, limitChurn(vs2, changed, 3333))
+}
+
+func TestUpdateValidatorSetChurn(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	store := state.NewMemKVStore()
+
+	candidates := candidatesFromActors(newActors(3), []int{300, 300, 400})
+	for _, c := range candidates {
+		saveCandidate(store, c)
+	}
+	change, err := UpdateValidatorSet(store, 1)
+	require.NoError(err)
+	require.Empty(change)
+
+	// one candidate leaves, one grows and one joins, too much for one block
+	removeCandidate(store, pks[0])
+	candidates[2].Shares = 500
+	saveCandidate(store, candidates[2])
+	saveCandidate(store, &Candidate{PubKey: pks[3], Owner: newActors(4)[3], Shares: 200})
+
+	change, err = UpdateValidatorSet(store, 2)
+	require.NoError(err)
+	assert.Len(change, 3)
+	assert.Equal([]ValidatorChange{{pks[0], 134, 0}, {pks[3], 67, 200}},
+		loadDeferredChanges(store, 2))
+	assert.Equal([]ValidatorPower{{pks[0], 134}, {pks[1], 300}, {pks[2], 500},
+		{pks[3], 67}}, loadValidatorSet(store, 3))
+
+	// the deferred changes are made by the next blocks
+	change, err = UpdateValidatorSet(store, 3)
+	require.NoError(err)
+	assert.Len(change, 2)
+	assert.Nil(loadDeferredChanges(store, 3))
+	assert.Equal([]ValidatorPower{{pks[1], 300}, {pks[2], 500}, {pks[3], 200}},
+		loadValidatorSet(store, 4))
+
+	change, err = UpdateValidatorSet(store, 4)
+	require.NoError(err)
+	assert.Empty(change)
+}
+
+func TestUpdateValidatorSetMinValidators(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	store := state.NewMemKVStore()
+	params := loadParams(store)
+	params.MinValidators = 3
+	saveParams(store, params)
+
+	candidates := candidatesFromActors(newActors(5), []int{10, 10, 200, 100, 100})
+	for _, c := range candidates[:3] {
+		saveCandidate(store, c)
+	}
+	_, err := UpdateValidatorSet(store, 1)
+	require.NoError(err)
+
+	// two small validators are replaced by two large candidates, the churn
+	// removes both but only has room to add one of their replacements
+	removeCandidate(store, pks[0])
+	removeCandidate(store, pks[1])
+	for _, c := range candidates[3:] {
+		c.VotingPower = 0
+		saveCandidate(store, c)
+	}
+
+	// so the most powerful one is kept until the other joins
+	_, err = UpdateValidatorSet(store, 2)
+	require.NoError(err)
+	assert.Equal([]ValidatorPower{{pks[0], 10}, {pks[2], 200}, {pks[3], 53}},
+		loadValidatorSet(store, 3))
+	_, err = UpdateValidatorSet(store, 3)
+	require.NoError(err)
+	assert.Equal([]ValidatorPower{{pks[2], 200}, {pks[3], 100}, {pks[4], 30}},
+		loadValidatorSet(store, 4))
+}
+
+func TestRotateValidators(t *testing.T) {
+	assert := assert.New(t)
+	store := state.NewMemKVStore()
+
+	// a key rotated twice before the update is recorded from the first key
+	addKeyRotation(store, pks[0], pks[1])
+	addKeyRotation(store, pks[3], pks[4])
+	addKeyRotation(store, pks[1], pks[2])
+	rotations := loadKeyRotations(store)
+	assert.Equal([]keyRotation{{pks[0], pks[2]}, {pks[3], pks[4]}}, rotations)
+
+	// the validators take the new keys which are still candidates
+	saveCandidate(store, &Candidate{PubKey: pks[2], Shares: 10})
+	vs := Validators{
+		{PubKey: pks[3], VotingPower: 5},
+		{PubKey: pks[0], VotingPower: 10},
+	}
+	assert.Equal(Validators{
+		{PubKey: pks[2], VotingPower: 10},
+		{PubKey: pks[3], VotingPower: 5},
+	}, rotateValidators(store, vs, rotations))
+}
+
+func TestUpdateValidatorSetReplaced(t *testing.T) {
+	assert, require := assert.New(t), require.New(t)
+	store := state.NewMemKVStore()
+
+	// a single validator, with the default churn limit
+	owner := newActors(1)[0]
+	saveCandidate(store, &Candidate{PubKey: pks[0], Owner: owner, Shares: 100})
+	_, err := UpdateValidatorSet(store, 1)
+	require.NoError(err)
+
+	// moves to a new key, which replaces the whole set
+	removeCandidate(store, pks[0])
+	saveCandidate(store, &Candidate{PubKey: pks[1], Owner: owner, Shares: 100})
+
+	// the new key gains power as the old one loses it, the set never has
+	// less power than it started with
+	height := int64(2)
+	for ; height < 20; height++ {
+		_, err = UpdateValidatorSet(store, height)
+		require.NoError(err)
+		set := loadValidatorSet(store, height+1)
+		var total uint64
+		for _, v := range set {
+			total += v.Power
+		}
+		assert.True(total >= 100, "height %d: %v", height, set)
+		if loadDeferredChanges(store, height) == nil {
+			break
+		}
+	}
+	assert.Equal([]ValidatorPower{{pks[1], 100}}, loadValidatorSet(store, height+1))
 }